@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wdantuma/s57-tiler/s57"
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+)
+
+// parseRoute parses "lon,lat;lon,lat;..."
+func parseRoute(value string) ([]s57.RoutePoint, error) {
+	route := make([]s57.RoutePoint, 0)
+	for _, p := range strings.Split(value, ";") {
+		parts := strings.Split(strings.TrimSpace(p), ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid route point %s", p)
+		}
+		lon, lonErr := strconv.ParseFloat(parts[0], 64)
+		lat, latErr := strconv.ParseFloat(parts[1], 64)
+		if lonErr != nil || latErr != nil {
+			return nil, fmt.Errorf("invalid route point %s", p)
+		}
+		route = append(route, s57.RoutePoint{Lon: lon, Lat: lat})
+	}
+	return route, nil
+}
+
+// readRoute reads the LineString of a GeoJSON route file, a feature or a bare geometry
+func readRoute(path string) ([]s57.RoutePoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var feature struct {
+		Type        string          `json:"type"`
+		Geometry    json.RawMessage `json:"geometry"`
+		Coordinates [][]float64     `json:"coordinates"`
+	}
+	if err := json.Unmarshal(data, &feature); err != nil {
+		return nil, err
+	}
+	if feature.Type == "Feature" {
+		if err := json.Unmarshal(feature.Geometry, &feature); err != nil {
+			return nil, err
+		}
+	}
+	if feature.Type != "LineString" {
+		return nil, fmt.Errorf("%s is not a LineString route", path)
+	}
+	route := make([]s57.RoutePoint, 0)
+	for _, c := range feature.Coordinates {
+		if len(c) < 2 {
+			return nil, fmt.Errorf("invalid coordinate in %s", path)
+		}
+		route = append(route, s57.RoutePoint{Lon: c[0], Lat: c[1]})
+	}
+	return route, nil
+}
+
+// checkRoute runs the checkroute command
+func checkRoute(args []string) {
+	flags := flag.NewFlagSet("checkroute", flag.ExitOnError)
+	inputPath := flags.String("in", "./charts", "Input path S-57 ENC's")
+	routeFlag := flags.String("route", "", "Route as lon,lat;lon,lat;...")
+	routeFile := flags.String("routefile", "", "GeoJSON file with the route as LineString")
+	safetyDepth := flags.Float64("safetydepth", 5, "Safety depth in meters")
+	corridorWidth := flags.Float64("corridor", 100, "Width of the corridor around the route in meters")
+	asJSON := flags.Bool("json", false, "Output the hazards as JSON")
+	crc := flags.String("crc", dataset.CRC_REFUSE, "Cells that don't match the CRC in the catalog, refuse (skip them) or warn")
+	s63 := addS63Flags(flags)
+	flags.Parse(args)
+
+	var route []s57.RoutePoint
+	var err error
+	switch {
+	case *routeFlag != "" && *routeFile != "":
+		log.Fatal("route and routefile cannot be used together")
+	case *routeFlag != "":
+		route, err = parseRoute(*routeFlag)
+	case *routeFile != "":
+		route, err = readRoute(*routeFile)
+	default:
+		log.Fatal("No route given")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(route) < 2 {
+		log.Fatal("A route needs at least two points")
+	}
+	checkCRC(*crc)
+
+	datasets, close := s63.getDatasets(*inputPath)
+	defer close()
+	datasets = checkCatalogs(datasets, *crc)
+	tiler := s57.NewS57Tiler(datasets, 0, 0, s57.Options{})
+	hazards := tiler.CheckRoute(route, *safetyDepth, *corridorWidth)
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(hazards, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for _, h := range hazards {
+		fmt.Printf("Leg %d, %.0f m: %s %s %s at %.6f,%.6f (%.0f m off track)\n", h.Leg+1, h.Distance, h.Layer, h.Name, h.Reason, h.Lon, h.Lat, h.Offset)
+	}
+	fmt.Printf("%d hazards found\n", len(hazards))
+}
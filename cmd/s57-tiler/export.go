@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/wdantuma/s57-tiler/s57"
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+)
+
+// export runs the export command
+func export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	inputPath := flags.String("in", "./charts", "Input path S-57 ENC's")
+	outputPath := flags.String("out", "./export", "Output directory, every cell gets a directory with a file per object class")
+	format := flags.String("format", s57.EXPORT_GEOJSON, "Output format, geojson (newline delimited) or fgb (FlatGeobuf)")
+	boundsFlag := flags.String("bounds", "", "Only export within W,N,E,S, geometries are clipped")
+	crc := flags.String("crc", dataset.CRC_REFUSE, "Cells that don't match the CRC in the catalog, refuse (skip them) or warn")
+	s63 := addS63Flags(flags)
+	flags.Parse(args)
+
+	if *format != s57.EXPORT_GEOJSON && *format != s57.EXPORT_FLATGEOBUF {
+		log.Fatalf("Invalid format %s, use geojson or fgb", *format)
+	}
+	var bounds *m.Extrema = nil
+	if *boundsFlag != "" {
+		bounds = parseBounds(*boundsFlag)
+	}
+	checkCRC(*crc)
+
+	datasets, close := s63.getDatasets(*inputPath)
+	defer close()
+	datasets = checkCatalogs(datasets, *crc)
+	tiler := s57.NewS57Tiler(datasets, 0, 0, s57.Options{})
+	for _, dataset := range datasets {
+		for _, file := range dataset.Files {
+			count, err := tiler.Export(*outputPath, file, *format, bounds)
+			if err != nil {
+				fatal(close, err)
+			}
+			fmt.Printf("Dataset: %s, Map: %s, Exported: %d features\n", dataset.Id, file.Id, count)
+			tiler.ReleaseCell(file)
+		}
+	}
+}
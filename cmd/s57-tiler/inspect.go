@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+)
+
+// inspectCell is the result for a cell in the inspect report
+type inspectCell struct {
+	Id      string `json:"id"`
+	Path    string `json:"path"`
+	Corrupt bool   `json:"corrupt"`
+}
+
+// inspectDataset is the result for a dataset in the inspect report
+type inspectDataset struct {
+	Id     string                `json:"id"`
+	Report dataset.CatalogReport `json:"report"`
+	Cells  []inspectCell         `json:"cells"`
+}
+
+// inspect runs the inspect command, it checks the catalogs and the CRC of
+// every file and exits with status 1 when problems are found
+func inspect(args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inputPath := flags.String("in", "./charts", "Input path S-57 ENC's")
+	asJSON := flags.Bool("json", false, "Output the report as JSON")
+	s63 := addS63Flags(flags)
+	flags.Parse(args)
+
+	datasets, close := s63.getDatasets(*inputPath)
+	defer close()
+	results := make([]inspectDataset, 0)
+	problems := 0
+	for _, d := range datasets {
+		result := inspectDataset{Id: d.Id, Report: d.Report, Cells: make([]inspectCell, 0)}
+		for _, file := range d.Files {
+			result.Cells = append(result.Cells, inspectCell{Id: file.Id, Path: file.Path, Corrupt: d.Corrupt(file)})
+		}
+		problems += len(d.Report.Problems)
+		results = append(results, result)
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, r := range results {
+			if r.Report.Catalog == "" {
+				fmt.Printf("Dataset: %s, %d cells without a catalog, not verified\n", r.Id, len(r.Cells))
+			} else {
+				fmt.Printf("Dataset: %s, Catalog: %s, Files: %d, Cells: %d, CRC verified: %d\n", r.Id, r.Report.Catalog, r.Report.Files, r.Report.Cells, r.Report.Verified)
+			}
+			for _, p := range r.Report.Problems {
+				fmt.Printf("  %s %s, %s\n", p.File, p.Problem, p.Message)
+			}
+			for _, c := range r.Cells {
+				status := "ok"
+				if c.Corrupt {
+					status = "corrupt"
+				}
+				fmt.Printf("  Cell %s: %s\n", c.Id, status)
+			}
+		}
+		fmt.Printf("%d problems found\n", problems)
+	}
+	if problems > 0 {
+		close()
+		os.Exit(1)
+	}
+}
@@ -5,25 +5,169 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 
-	"github.com/lukeroth/gdal"
 	"github.com/wdantuma/s57-tiler/s57"
 	"github.com/wdantuma/s57-tiler/s57/dataset"
 	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
 )
 
+// parseBounds parses W,N,E,S
+func parseBounds(value string) *m.Extrema {
+	bounds := &m.Extrema{}
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		log.Fatal("Invalid bounds")
+	}
+	for i, p := range parts {
+		if v, err := strconv.ParseFloat(p, 64); err == nil {
+			switch i {
+			case 0:
+				bounds.W = v
+			case 1:
+				bounds.N = v
+			case 2:
+				bounds.E = v
+			case 3:
+				bounds.S = v
+			}
+		} else {
+			log.Fatal("Invalid bounds")
+		}
+	}
+	return bounds
+}
+
+// s63Flags are the flags for S-63 encrypted cells
+type s63Flags struct {
+	permits *string
+	hwId    *string
+	saCert  *string
+}
+
+func addS63Flags(flags *flag.FlagSet) s63Flags {
+	return s63Flags{
+		permits: flags.String("permits", "", "PERMIT.TXT with the cell permits to decrypt S-63 cells"),
+		hwId:    flags.String("hwid", "", "HW_ID of the S-63 user permit, 10 hex digits"),
+		saCert:  flags.String("sa-cert", "", "Public key (IHO.PUB) or certificate (IHO.CRT) of the S-63 scheme administrator to verify the cell signatures"),
+	}
+}
+
+// getDatasets returns the datasets, with a permit file the S-63 cells are
+// decrypted, call close when done to remove the decrypted cells. Deferred
+// calls don't run on log.Fatal, use fatal after getDatasets. The decrypted
+// cells are also removed when interrupted, e.g. when stopping -serve.
+func (f s63Flags) getDatasets(inputPath string) ([]dataset.Dataset, func()) {
+	if *f.permits == "" {
+		datasets, err := dataset.GetS57Datasets(inputPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return datasets, func() {}
+	}
+	if *f.hwId == "" {
+		log.Fatal("A HW_ID is needed to decrypt S-63 cells")
+	}
+	s63, err := dataset.NewS63(*f.permits, *f.hwId, *f.saCert)
+	if err != nil {
+		log.Fatal(err)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		s63.Close()
+		os.Exit(1)
+	}()
+	datasets, err := s63.GetS57Datasets(inputPath)
+	if err != nil {
+		s63.Close()
+		log.Fatal(err)
+	}
+	return datasets, s63.Close
+}
+
+// fatal removes the decrypted cells and exits
+func fatal(close func(), err error) {
+	close()
+	log.Fatal(err)
+}
+
+// checkCRC checks the crc flag, before the cells are decrypted
+func checkCRC(crc string) {
+	if crc != dataset.CRC_REFUSE && crc != dataset.CRC_WARN {
+		log.Fatalf("Invalid crc %s, use refuse or warn", crc)
+	}
+}
+
+// checkCatalogs prints the problems found in the catalogs to stderr and
+// leaves out the cells that don't match their CRC unless crc is warn
+func checkCatalogs(datasets []dataset.Dataset, crc string) []dataset.Dataset {
+	for i, d := range datasets {
+		for _, p := range d.Report.Problems {
+			source := d.Report.Catalog
+			if source == "" {
+				source = d.Id
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s %s, %s\n", source, p.File, p.Problem, p.Message)
+		}
+		if crc == dataset.CRC_WARN {
+			continue
+		}
+		files := make([]dataset.File, 0, len(d.Files))
+		for _, file := range d.Files {
+			if d.Corrupt(file) {
+				fmt.Fprintf(os.Stderr, "Skipping %s of %s, it doesn't match its CRC\n", file.Id, d.Id)
+				continue
+			}
+			files = append(files, file)
+		}
+		datasets[i].Files = files
+	}
+	return datasets
+}
+
 func main() {
 
-	driver, err := gdal.GetDriverByName("S57")
+	err := ogr.RegisterS57()
 	if err != nil {
 		log.Fatal(err)
 	}
-	driver.Register()
 
 	// set gdal options
 	os.Setenv("OGR_GEOMETRY_ACCEPT_UNCLOSED_RING", "NO")
+	if os.Getenv("OGR_S57_OPTIONS") == "" {
+		// recode ATTF/NATF values to UTF-8 using the lexical level in the DSSI
+		os.Setenv("OGR_S57_OPTIONS", "LNAM_REFS=ON,UPDATES=APPLY,RECODE_BY_DSSI=ON")
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "checkroute" {
+		os.Setenv("CPL_LOG", "/dev/null") // supress gdal errors
+		checkRoute(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Setenv("CPL_LOG", "/dev/null") // supress gdal errors
+		export(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		os.Setenv("CPL_LOG", "/dev/null") // supress gdal errors
+		inspect(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		search(os.Args[2:])
+		return
+	}
 
 	outputPath := flag.String("out", "./static/charts", "Output directory for vector tiles")
 	inputPath := flag.String("in", "./charts", "Input path S-57 ENC's")
@@ -32,20 +176,28 @@ func main() {
 	boundsFlag := flag.String("bounds", "", "W,N,E,S")
 	debug := flag.Bool("debug", false, "Show debug info")
 	at := flag.String("at", "", "lon,lat")
+	crc := flag.String("crc", dataset.CRC_REFUSE, "Cells that don't match the CRC in the catalog, refuse (skip them) or warn")
+	validate := flag.Bool("validate", false, "Validate tiles against the MVT 2.1 spec")
+	repair := flag.Bool("repair", false, "Repair MVT spec violations found by -validate")
+	omitLNAM := flag.Bool("omitlnam", false, "Leave out the LNAM attribute, features keep their id")
+	draught := flag.Float64("draught", 0, "Draught in meters, generates an UNSAFE layer and unsafe.geojson for draught + safetymargin")
+	safetyMargin := flag.Float64("safetymargin", 1, "Safety margin under the keel in meters")
+	dangerRadius := flag.Float64("dangerradius", 50, "Radius in meters of the unsafe water around a point danger")
+	labels := flag.Bool("labels", false, "Generate a labels layer with a label point per named area and line")
+	labelLanguage := flag.String("label-language", "", "Add a name attribute with the international (OBJNAM) or national (NOBJNM) name, international|national")
+	attachments := flag.Bool("attachments", true, "Copy the TXTDSC, NTXTDS and PICREP files to the output and link them in the tiles")
+	depthUnits := flag.String("depth-units", "", "Convert depths and heights to metres|feet|fathoms, heights are in feet for feet and fathoms")
+	serveAddress := flag.String("serve", "", "Serve feature queries on address (e.g. :8080) instead of generating tiles")
+	maxCells := flag.Int("maxcells", 64, "Cells kept in memory by -serve, the least recently used cells are released, 0 for no limit")
+	s63 := addS63Flags(flag.CommandLine)
+	simplify := flag.String("simplify", "", "Simplification per layer, layer=none|dp|visvalingam|shared[:tolerance in pixels],... (* for all other layers)")
 	flag.Parse()
 
 	if !*debug {
 		os.Setenv("CPL_LOG", "/dev/null") // supress gdal errors
 	}
 
-	datasets, err := dataset.GetS57Datasets(*inputPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if len(datasets) == 0 {
-		fmt.Println("No datasets found")
-		return
-	}
+	checkCRC(*crc)
 
 	if *at != "" && *boundsFlag != "" {
 		log.Fatal("at and bounds cannot be used together")
@@ -53,27 +205,7 @@ func main() {
 
 	var bounds *m.Extrema = nil
 	if *boundsFlag != "" {
-		bounds = &m.Extrema{}
-		parts := strings.Split(*boundsFlag, ",")
-		if len(parts) != 4 {
-			log.Fatal("Invalid bounds")
-		}
-		for i, p := range parts {
-			if v, err := strconv.ParseFloat(p, 64); err == nil {
-				switch i {
-				case 0:
-					bounds.W = v
-				case 1:
-					bounds.N = v
-				case 2:
-					bounds.E = v
-				case 3:
-					bounds.S = v
-				}
-			} else {
-				log.Fatal("Invalid bounds")
-			}
-		}
+		bounds = parseBounds(*boundsFlag)
 	}
 
 	var tile *m.TileID = nil
@@ -93,34 +225,103 @@ func main() {
 		}
 	}
 
-	tiler := s57.NewS57Tiler(datasets, *minzoom, *maxzoom)
+	if *repair && !*validate {
+		log.Fatal("repair can only be used together with validate")
+	}
+
+	simplification, err := s57.ParseSimplification(*simplify)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *labelLanguage != "" && *labelLanguage != s57.LABEL_INTERNATIONAL && *labelLanguage != s57.LABEL_NATIONAL {
+		log.Fatalf("Invalid label language %s, use international or national", *labelLanguage)
+	}
+
+	if *depthUnits != "" && *depthUnits != s57.DEPTH_METRES && *depthUnits != s57.DEPTH_FEET && *depthUnits != s57.DEPTH_FATHOMS {
+		log.Fatalf("Invalid depth units %s, use metres, feet or fathoms", *depthUnits)
+	}
 
+	datasets, close := s63.getDatasets(*inputPath)
+	defer close()
+	datasets = checkCatalogs(datasets, *crc)
+	if len(datasets) == 0 {
+		fmt.Println("No datasets found")
+		return
+	}
+
+	options := s57.Options{Validate: *validate, Repair: *repair, Simplification: simplification, OmitLNAM: *omitLNAM, Labels: *labels, LabelLanguage: *labelLanguage, Attachments: *attachments, DepthUnits: *depthUnits}
+	if *draught > 0 {
+		options.SafetyDepth = *draught + *safetyMargin
+		options.DangerRadius = *dangerRadius
+	}
+
+	if *serveAddress != "" {
+		options.MaxCells = *maxCells
+	}
+
+	tiler := s57.NewS57Tiler(datasets, *minzoom, *maxzoom, options)
+
+	if *serveAddress != "" {
+		fatal(close, serve(*serveAddress, tiler, *minzoom, *maxzoom))
+	}
+
+	searchEntries := make([]s57.SearchEntry, 0)
 	for _, dataset := range datasets {
 		for _, file := range dataset.Files {
-			for z := *minzoom; z <= *maxzoom; z++ {
-				var tiles map[string]m.TileID = make(map[string]m.TileID)
-				if tile != nil {
-					tiles = make(map[string]m.TileID)
-					tiles["tile"] = *tile
-				} else {
+			var tiles map[string]m.TileID = make(map[string]m.TileID)
+			if tile != nil {
+				tiles["tile"] = *tile
+			} else {
+				for z := *minzoom; z <= *maxzoom; z++ {
 					if bounds != nil {
-						tiles = tiler.GetTilesForBounds(nil, *bounds, z)
+						tiles = tiler.GetTilesForBounds(tiles, *bounds, z)
 					} else {
-						tiles = tiler.GetTiles(file, z)
+						for k, t := range tiler.GetTiles(file, z) {
+							tiles[k] = t
+						}
 					}
 				}
+			}
 
-				total := len(tiles)
-				n := 0
-				for k := range tiles {
-					tiler.GenerateTile(*outputPath, file, tiles[k])
-					done := float64(n) / float64(total) * 100
-					fmt.Printf("\rDataset: %s, Map: %s, Zoom: %d, Processed: %.0f %%    ", dataset.Id, file.Id, z, done)
-					n++
+			err := tiler.GenerateTiles(*outputPath, file, tiles, func(done int, total int) {
+				fmt.Printf("\rDataset: %s, Map: %s, Zoom: %d-%d, Processed: %.0f %%    ", dataset.Id, file.Id, *minzoom, *maxzoom, float64(done)/float64(total)*100)
+			})
+			if err != nil {
+				fatal(close, err)
+			}
+			fmt.Printf("\rDataset: %s, Map: %s, Zoom: %d-%d, Processed: 100 %%    \n", dataset.Id, file.Id, *minzoom, *maxzoom)
+			if err := tiler.GenerateMetaData(*outputPath, dataset, file); err != nil {
+				fatal(close, err)
+			}
+			if options.Validate {
+				n, err := tiler.WriteValidationReport(*outputPath, file)
+				if err != nil {
+					fatal(close, err)
+				}
+				if n > 0 {
+					fmt.Printf("Warning: %s has %d MVT spec violations, see %s\n", file.Id, n, filepath.Join(*outputPath, file.Id, s57.VALIDATION_REPORT))
+				}
+			}
+			if tiler.NonMetric(file) {
+				fmt.Printf("Warning: %s has depths or heights not in metres\n", file.Id)
+			}
+			if options.Attachments {
+				if err := tiler.GenerateAttachments(*outputPath, file); err != nil {
+					fatal(close, err)
+				}
+			}
+			if options.SafetyDepth > 0 {
+				if err := tiler.GenerateUnsafeWater(*outputPath, file); err != nil {
+					fatal(close, err)
 				}
-				fmt.Printf("\rDataset: %s, Map: %s, Zoom: %d, Processed: 100 %%    \n", dataset.Id, file.Id, z)
-				tiler.GenerateMetaData(*outputPath, dataset, file)
 			}
+			searchEntries = append(searchEntries, tiler.SearchEntries(file)...)
+			tiler.ReleaseCell(file)
 		}
 	}
+	err = s57.WriteSearchIndex(filepath.Join(*outputPath, s57.SEARCH_INDEX), searchEntries)
+	if err != nil {
+		fatal(close, err)
+	}
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/wdantuma/s57-tiler/s57"
+)
+
+// search runs the search command on the index written during tiling
+func search(args []string) {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	indexPath := flags.String("index", "./static/charts/"+s57.SEARCH_INDEX, "Search index written during tiling")
+	limit := flags.Int("limit", 20, "Maximum number of results, 0 for all")
+	asJSON := flags.Bool("json", false, "Output the results as JSON")
+	flags.Parse(args)
+
+	query := strings.Join(flags.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		log.Fatal("No search text given")
+	}
+	entries, err := s57.ReadSearchIndex(*indexPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	results := s57.Search(entries, query, *limit)
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	for _, e := range results {
+		fmt.Printf("%s (%s) at %.6f,%.6f in %s\n", e.Name, e.Class, e.Lon, e.Lat, e.Cell)
+	}
+	fmt.Printf("%d results found\n", len(results))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/wdantuma/s57-tiler/s57"
+)
+
+type server struct {
+	// the tiler caches cells and is not safe for concurrent use
+	lock    sync.Mutex
+	tiler   queryService
+	minZoom int
+	maxZoom int
+}
+
+type queryService interface {
+	Query(lon float64, lat float64, radius float64, zoom int) s57.GeoJSONFeatureCollection
+	Search(query string, limit int) []s57.SearchEntry
+}
+
+func floatParameter(r *http.Request, name string, defaultValue *float64) (float64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		if defaultValue == nil {
+			return 0, false
+		}
+		return *defaultValue, true
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	return v, err == nil
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, value interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	out, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(out)
+}
+
+// query handles /query?lon=..&lat=..&radius=..&zoom=.., radius in meters
+func (s *server) query(w http.ResponseWriter, r *http.Request) {
+	defaultRadius := 20.0
+	defaultZoom := float64(s.maxZoom)
+	lon, lonOk := floatParameter(r, "lon", nil)
+	lat, latOk := floatParameter(r, "lat", nil)
+	radius, radiusOk := floatParameter(r, "radius", &defaultRadius)
+	zoom, zoomOk := floatParameter(r, "zoom", &defaultZoom)
+	// the mercator scale is infinite at the poles, positions beyond the tiles are refused
+	if !lonOk || !latOk || !radiusOk || !zoomOk || lat < -s57.MAX_LATITUDE || lat > s57.MAX_LATITUDE || lon < -180 || lon > 180 || radius < 0 ||
+		zoom < float64(s.minZoom) || zoom > float64(s.maxZoom) {
+		http.Error(w, "Invalid lon, lat, radius or zoom", http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	result := s.tiler.Query(lon, lat, radius, int(zoom))
+	s.lock.Unlock()
+	writeJSON(w, "application/geo+json", result)
+}
+
+// search handles /search?q=..&limit=.., the index is built on the first search
+func (s *server) search(w http.ResponseWriter, r *http.Request) {
+	defaultLimit := 20.0
+	query := r.URL.Query().Get("q")
+	limit, limitOk := floatParameter(r, "limit", &defaultLimit)
+	if query == "" || !limitOk || limit < 0 {
+		http.Error(w, "Invalid q or limit", http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	result := s.tiler.Search(query, int(limit))
+	s.lock.Unlock()
+	writeJSON(w, "application/json", result)
+}
+
+func serve(address string, tiler queryService, minZoom int, maxZoom int) error {
+	s := &server{tiler: tiler, minZoom: minZoom, maxZoom: maxZoom}
+	http.HandleFunc("/query", s.query)
+	http.HandleFunc("/search", s.search)
+	log.Printf("Listening on %s\n", address)
+	return http.ListenAndServe(address, nil)
+}
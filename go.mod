@@ -8,6 +8,7 @@ require (
 	github.com/lukeroth/gdal v0.0.0-20230818145556-62d5095a1cda
 	github.com/tburke/iso8211 v0.0.0-20190905204635-916caaad4cc1
 	github.com/wdantuma/signalk-server-go v0.0.0-20240715110006-b0c17acbf5fa
+	golang.org/x/crypto v0.31.0
 	google.golang.org/protobuf v1.31.0
 )
 
@@ -0,0 +1,129 @@
+package s57
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	"github.com/wdantuma/s57-tiler/s57/vsi"
+)
+
+// directory in the output of a cell with its text and picture files
+const ATTACHMENT_DIR = "files"
+
+// attributes referencing a file in the exchange set, the text ones are
+// converted to UTF-8
+var attachmentAttributes = map[string]bool{"TXTDSC": true, "NTXTDS": true, "PICREP": false}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9._-]`)
+
+// normaliseName returns a lower case file name safe to use in a URL
+func normaliseName(name string) string {
+	return unsafeNameChars.ReplaceAllString(strings.ToLower(filepath.Base(name)), "_")
+}
+
+// findAttachment looks for a referenced file in the directory of the cell
+// and in the directory above it, the exchange set root, ignoring case
+func findAttachment(cellPath string, name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	dir := vsi.Dir(cellPath)
+	for _, d := range []string{dir, vsi.Dir(dir)} {
+		names, err := vsi.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				return vsi.Join(d, n)
+			}
+		}
+	}
+	return ""
+}
+
+// textToUTF8 converts a text file to UTF-8, UCS-2 when it has a byte order
+// mark or looks like it, otherwise UTF-8 when valid and else ISO 8859-1
+func textToUTF8(data []byte) []byte {
+	ucs2 := bytes.HasPrefix(data, []byte{0xff, 0xfe})
+	if !ucs2 && len(data) >= 2 && len(data)%2 == 0 {
+		// ASCII characters in UCS-2 have a zero high byte
+		zeros := 0
+		for i := 1; i < len(data); i += 2 {
+			if data[i] == 0 {
+				zeros++
+			}
+		}
+		ucs2 = zeros > len(data)/4
+	}
+	switch {
+	case ucs2:
+		data = bytes.TrimPrefix(data, []byte{0xff, 0xfe})
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+		return []byte(string(utf16.Decode(units)))
+	case utf8.Valid(data):
+		return data
+	default:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return []byte(string(runes))
+	}
+}
+
+// addAttachments rewrites the TXTDSC, NTXTDS and PICREP attributes to the
+// URL of the file relative to the chart directory, when the file exists
+func (s *s57Tiler) addAttachments(c *cell, file dataset.File) {
+	for _, features := range c.layers {
+		for _, feature := range features {
+			for i, field := range feature.fields {
+				text, ok := attachmentAttributes[field.key]
+				if !ok {
+					continue
+				}
+				value, _ := field.value.value.(string)
+				source := findAttachment(file.SourcePath(), value)
+				if source == "" {
+					continue
+				}
+				name := normaliseName(source)
+				c.attachments[name] = attachment{source: source, text: text}
+				feature.fields[i].value.value = ATTACHMENT_DIR + "/" + name
+			}
+		}
+	}
+}
+
+// GenerateAttachments copies the files referenced by the features of a cell
+// to the files directory of the chart
+func (s *s57Tiler) GenerateAttachments(outPath string, file dataset.File) error {
+	c := s.getCell(file)
+	if len(c.attachments) == 0 {
+		return nil
+	}
+	dir := filepath.Join(outPath, file.Id, ATTACHMENT_DIR)
+	os.MkdirAll(dir, 0700)
+	for name, a := range c.attachments {
+		data, err := vsi.ReadFile(a.source)
+		if err != nil {
+			return err
+		}
+		if a.text {
+			data = textToUTF8(data)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
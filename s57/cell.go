@@ -0,0 +1,279 @@
+package s57
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+type fieldValue struct {
+	key   string
+	value Value
+	list  bool // a list attribute, the value holds the comma separated items
+}
+
+// cellFeature is a feature read once from the cell, with its attributes
+// decoded and its own copy of the geometry
+type cellFeature struct {
+	id         uint64 // from the LNAM, AGEN+FIDN+FIDS, 0 when the feature has no LNAM
+	layer      string
+	derived    bool // computed from other features, it has no OGR geometry
+	geomType   ogr.GeometryType
+	fields     []fieldValue
+	geometry   ogr.Geometry
+	projected  tileGeometry
+	simplified map[uint64]tileGeometry // simplified geometry per zoom level
+	edges      *edgeIndex              // shared edges of the cell, when simplified by shared edges
+	envelope   ogr.Envelope
+	scamin     float64
+	scamax     float64
+	label      *xy        // label position, computed on first use
+	units      *cellUnits // units of the cell, nil for derived features
+}
+
+// cell holds the features of all layers of a cell in memory, so the cell is
+// opened and parsed only once for all tiles and zoom levels
+type cell struct {
+	layers      map[string][]*cellFeature
+	indexes     map[string]*strTree
+	attachments map[string]attachment // referenced files by their name in the output
+	units       cellUnits
+}
+
+// attachment is a text or picture file referenced by a feature
+type attachment struct {
+	source string
+	text   bool
+}
+
+// featureId hashes the 64 bit LNAM to 53 bits, ids above 2^53 can't be
+// represented exactly by JavaScript numbers. Features without LNAM get id 0.
+func featureId(agen uint64, fidn uint64, fids uint64) uint64 {
+	lnam := agen<<48 | fidn<<16 | fids
+	if lnam == 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	binary.Write(h, binary.BigEndian, lnam)
+	return h.Sum64() & (1<<53 - 1)
+}
+
+func readFeature(layerName string, feature *ogr.Feature) *cellFeature {
+	cf := &cellFeature{layer: layerName, simplified: make(map[uint64]tileGeometry)}
+	var agen, fidn, fids uint64
+	for i := 0; i < feature.FieldCount(); i++ {
+		if !feature.IsFieldSet(i) {
+			continue
+		}
+		fieldDef := feature.FieldDefinition(i)
+		key := fieldDef.Name()
+		var value interface{}
+		vt := VT_STRING
+		switch fieldDef.Type() {
+		case ogr.FT_StringList:
+			st := string(feature.FieldAsString(i))
+			value = st[strings.Index(st, ":")+1 : len(st)-1]
+		case ogr.FT_Integer:
+			vt = VT_INT
+			value = feature.FieldAsInteger64(i)
+		case ogr.FT_Real:
+			vt = VT_FLOAT
+			value = feature.FieldAsFloat64(i)
+		default:
+			// names must be valid UTF-8 in the tiles whatever the driver returns
+			value = strings.ToValidUTF8(feature.FieldAsString(i), "\uFFFD")
+		}
+		if value != "" {
+			cf.fields = append(cf.fields, fieldValue{key: key, value: Value{fieldType: vt, value: value}, list: fieldDef.Type() == ogr.FT_StringList})
+		}
+		switch key {
+		case "SCAMIN":
+			cf.scamin = feature.FieldAsFloat64(i)
+		case "SCAMAX":
+			cf.scamax = feature.FieldAsFloat64(i)
+		case "AGEN":
+			agen = uint64(feature.FieldAsInteger64(i)) & 0xffff
+		case "FIDN":
+			fidn = uint64(feature.FieldAsInteger64(i)) & 0xffffffff
+		case "FIDS":
+			fids = uint64(feature.FieldAsInteger64(i)) & 0xffff
+		}
+	}
+	// the LNAM is unique for the producing agency, stable over updates and the
+	// same in every cell and tile the feature is in
+	cf.id = featureId(agen, fidn, fids)
+	geom := feature.Geometry()
+	cf.geometry = geom.Clone()
+	cf.geomType = cf.geometry.Type()
+	cf.envelope = cf.geometry.Envelope()
+	cf.projected = projectGeometry(&cf.geometry)
+	return cf
+}
+
+// floatValue returns a numeric attribute of the feature
+func (f *cellFeature) floatValue(key string) (float64, bool) {
+	for _, field := range f.fields {
+		if field.key != key {
+			continue
+		}
+		switch v := field.value.value.(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		case string:
+			value, err := strconv.ParseFloat(v, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+// stringValue returns an attribute of the feature as text
+func (f *cellFeature) stringValue(key string) string {
+	for _, field := range f.fields {
+		if field.key == key {
+			return fmt.Sprintf("%v", field.value.value)
+		}
+	}
+	return ""
+}
+
+func loadCell(file dataset.File) *cell {
+	c := &cell{layers: make(map[string][]*cellFeature), indexes: make(map[string]*strTree), attachments: make(map[string]attachment)}
+	datasource, err := ogr.OpenDataSource(file.Path, 0)
+	if err != nil {
+		// the cell is left empty, it could be opened when the datasets were read
+		log.Printf("Error opening %s: %s\n", file.Path, err)
+		c.units = metricUnits
+		return c
+	}
+	defer datasource.Destroy()
+	c.units = readUnits(datasource)
+	for layerName := range file.Layers {
+		l := datasource.LayerByName(layerName)
+		features := make([]*cellFeature, 0)
+		bounds := make([]rect, 0)
+		for feature := l.NextFeature(); feature != nil; feature = l.NextFeature() {
+			cf := readFeature(layerName, feature)
+			cf.units = &c.units
+			features = append(features, cf)
+			bounds = append(bounds, projectEnvelope(cf.envelope))
+			feature.Destroy()
+		}
+		c.layers[layerName] = features
+		c.indexes[layerName] = newStrTree(bounds)
+	}
+	return c
+}
+
+func (c *cell) destroy() {
+	for _, features := range c.layers {
+		for _, f := range features {
+			if !f.derived {
+				f.geometry.Destroy()
+			}
+		}
+	}
+	c.layers = nil
+	c.indexes = nil
+}
+
+// query returns the features of the layer whose envelope intersects the area
+func (c *cell) query(layerName string, area ogr.Envelope) []*cellFeature {
+	features := make([]*cellFeature, 0)
+	index, ok := c.indexes[layerName]
+	if !ok {
+		return features
+	}
+	for _, i := range index.query(projectEnvelope(area)) {
+		features = append(features, c.layers[layerName][i])
+	}
+	return features
+}
+
+// getCell returns the cached cell, the tiler keeps its own cells so every
+// worker has its own datasource. With MaxCells set the least recently used
+// cells are released.
+func (s *s57Tiler) getCell(file dataset.File) *cell {
+	c, ok := s.cells[file.Path]
+	if ok {
+		s.removeCellOrder(file.Path)
+		s.cellOrder = append(s.cellOrder, file.Path)
+	} else {
+		c = loadCell(file)
+		if s.options.Attachments {
+			s.addAttachments(c, file)
+		}
+		if s.options.SafetyDepth > 0 {
+			s.addUnsafeWater(c, file)
+		}
+		if s.options.LabelLanguage != "" {
+			s.addNames(c)
+		}
+		if s.options.Labels {
+			s.addLabels(c, file)
+		}
+		s.indexEdges(c)
+		s.cells[file.Path] = c
+		s.cellOrder = append(s.cellOrder, file.Path)
+		for s.options.MaxCells > 0 && len(s.cellOrder) > s.options.MaxCells {
+			s.ReleaseCell(dataset.File{Path: s.cellOrder[0]})
+		}
+	}
+	return c
+}
+
+func (s *s57Tiler) removeCellOrder(path string) {
+	for i, p := range s.cellOrder {
+		if p == path {
+			s.cellOrder = append(s.cellOrder[:i], s.cellOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// indexEdges builds one edge index for the areas of all layers simplified by
+// shared edges, so edges shared between e.g. DEPARE and LNDARE are simplified
+// once for both
+func (s *s57Tiler) indexEdges(c *cell) {
+	index := newEdgeIndex()
+	layerNames := make([]string, 0)
+	for layerName := range c.layers {
+		layerNames = append(layerNames, layerName)
+	}
+	// ring numbers don't depend on the map order
+	sort.Strings(layerNames)
+	for _, layerName := range layerNames {
+		simplification := s.layerSimplification(layerName)
+		if simplification.Method != SIMPLIFY_SHARED_EDGES {
+			continue
+		}
+		for _, f := range c.layers[layerName] {
+			if f.geomType != ogr.GT_Polygon {
+				continue
+			}
+			for _, part := range f.projected.parts {
+				index.addRing(part, simplification.Tolerance)
+			}
+			f.edges = index
+		}
+	}
+}
+
+// ReleaseCell frees the cached features of the cell, call it when all tiles
+// of the cell are generated
+func (s *s57Tiler) ReleaseCell(file dataset.File) {
+	if c, ok := s.cells[file.Path]; ok {
+		c.destroy()
+		delete(s.cells, file.Path)
+		s.removeCellOrder(file.Path)
+	}
+}
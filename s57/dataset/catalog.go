@@ -0,0 +1,234 @@
+package dataset
+
+// CATALOG.031 parsing, the catalogue directory (CATD) records list every file
+// of an exchange set with its implementation and CRC
+// see https://iho.int/uploads/user/pubs/standards/s-57/31Main.pdf part 3, 7.4.1
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tburke/iso8211"
+	"github.com/wdantuma/s57-tiler/s57/vsi"
+)
+
+const CATALOG_FILE = "CATALOG.031"
+
+// what to do with cells that don't match their CRC
+const (
+	CRC_REFUSE = "refuse"
+	CRC_WARN   = "warn"
+)
+
+// catalog problems
+const (
+	PROBLEM_INVALID = "invalid" // the catalog or one of its records can't be read
+	PROBLEM_MISSING = "missing" // a listed file doesn't exist
+	PROBLEM_CRC     = "crc"     // the CRC of a file doesn't match the catalog
+)
+
+// CatalogEntry is a CATD record
+type CatalogEntry struct {
+	File           string // path relative to the catalog, / separated
+	LongFile       string
+	Volume         string
+	Implementation string // BIN for ISO 8211 files, ASC, TXT, TIF, ...
+	CRC            string // CRC32 as 8 hex digits, empty when not given
+	Comment        string
+}
+
+// BaseCell returns true when the entry is a base cell
+func (e CatalogEntry) BaseCell() bool {
+	return e.Implementation == "BIN" && isBaseCell(e.File)
+}
+
+// CatalogProblem is a problem with the catalog or one of the files it lists
+type CatalogProblem struct {
+	File    string `json:"file"`
+	Problem string `json:"problem"`
+	Message string `json:"message"`
+}
+
+// CatalogReport is the result of reading a catalog and checking its files
+type CatalogReport struct {
+	Catalog  string           `json:"catalog"`
+	Files    int              `json:"files"`
+	Cells    int              `json:"cells"`
+	Verified int              `json:"verified"` // files that match their CRC
+	Problems []CatalogProblem `json:"problems"`
+}
+
+func (r *CatalogReport) add(file string, problem string, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, CatalogProblem{File: file, Problem: problem, Message: fmt.Sprintf(format, args...)})
+}
+
+// Problem returns the problem with a file, "" when there is none
+func (r CatalogReport) Problem(file string) string {
+	for _, p := range r.Problems {
+		if p.File == file {
+			return p.Problem
+		}
+	}
+	return ""
+}
+
+// subfields returns the subfields of a field keyed by tag, only the first
+// repetition for repeating fields
+func subfields(field iso8211.Field) map[string]string {
+	values := make(map[string]string)
+	format := field.FieldType.Format()
+	for i, sf := range format {
+		if i >= len(field.SubFields) {
+			break
+		}
+		tag := strings.TrimPrefix(string(sf.Tag), "*")
+		if s, ok := field.SubFields[i].(string); ok {
+			values[tag] = strings.TrimSpace(s)
+		} else {
+			values[tag] = fmt.Sprintf("%v", field.SubFields[i])
+		}
+	}
+	return values
+}
+
+// validCRC returns true for a CRC of 8 hex digits
+func validCRC(crc string) bool {
+	_, err := strconv.ParseUint(crc, 16, 32)
+	return len(crc) == 8 && err == nil
+}
+
+// readCatalogEntries reads the CATD records of a catalog, records that can't
+// be read or are incomplete are reported as invalid
+func readCatalogEntries(data []byte, report *CatalogReport) (entries []CatalogEntry) {
+	entries = make([]CatalogEntry, 0)
+	record := 0
+	defer func() {
+		// the iso8211 package panics on some truncated records
+		if err := recover(); err != nil {
+			if record == 0 {
+				report.add(CATALOG_FILE, PROBLEM_INVALID, "can't read the catalog: %v", err)
+			} else {
+				report.add(CATALOG_FILE, PROBLEM_INVALID, "can't read record %d: %v", record, err)
+			}
+		}
+	}()
+	r := bytes.NewReader(data)
+	var l iso8211.LeadRecord
+	if err := l.Read(r); err != nil {
+		report.add(CATALOG_FILE, PROBLEM_INVALID, "can't read the catalog: %s", err)
+		return entries
+	}
+	if l.Header.RecordLength > uint64(len(data)) {
+		report.add(CATALOG_FILE, PROBLEM_INVALID, "the catalog is truncated")
+		return entries
+	}
+	for r.Len() > 0 {
+		record++
+		d := iso8211.DataRecord{Lead: &l}
+		remaining := r.Len()
+		if err := d.Read(r); err != nil {
+			report.add(CATALOG_FILE, PROBLEM_INVALID, "can't read record %d: %s", record, err)
+			break
+		}
+		if d.Header.RecordLength > uint64(remaining) {
+			report.add(CATALOG_FILE, PROBLEM_INVALID, "record %d is truncated", record)
+			break
+		}
+		var catd map[string]string
+		for _, field := range d.Fields {
+			if field.Tag == "CATD" {
+				catd = subfields(field)
+			}
+		}
+		if catd == nil {
+			report.add(CATALOG_FILE, PROBLEM_INVALID, "record %d has no CATD field", record)
+			continue
+		}
+		entry := CatalogEntry{
+			File:           strings.ReplaceAll(catd["FILE"], "\\", "/"),
+			LongFile:       catd["LFIL"],
+			Volume:         catd["VOLM"],
+			Implementation: strings.ToUpper(catd["IMPL"]),
+			CRC:            strings.ToUpper(catd["CRCS"]),
+			Comment:        catd["COMT"],
+		}
+		switch {
+		case entry.File == "":
+			report.add(CATALOG_FILE, PROBLEM_INVALID, "record %d has no FILE", record)
+		case len(entry.Implementation) != 3:
+			report.add(entry.File, PROBLEM_INVALID, "record %d has an invalid IMPL %q", record, entry.Implementation)
+		case entry.CRC != "" && !validCRC(entry.CRC):
+			report.add(entry.File, PROBLEM_INVALID, "record %d has an invalid CRCS %q", record, entry.CRC)
+		case isBaseCell(entry.File) && entry.Implementation != "BIN":
+			report.add(entry.File, PROBLEM_INVALID, "base cell with IMPL %s instead of BIN", entry.Implementation)
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// checkFile checks that a listed file exists and matches its CRC
+func checkFile(path string, entry CatalogEntry, report *CatalogReport) {
+	data, err := vsi.ReadFile(path)
+	if err != nil {
+		report.add(entry.File, PROBLEM_MISSING, "%s", err)
+		return
+	}
+	if entry.CRC == "" {
+		return
+	}
+	if crc := fmt.Sprintf("%08X", crc32.ChecksumIEEE(data)); crc != entry.CRC {
+		report.add(entry.File, PROBLEM_CRC, "CRC %s, catalog %s", crc, entry.CRC)
+		return
+	}
+	report.Verified++
+}
+
+// Corrupt returns true when a base cell or one of its update files doesn't
+// match its CRC in the catalog
+func (dataset Dataset) Corrupt(file File) bool {
+	dir := vsi.Dir(dataset.Report.Catalog)
+	for _, p := range dataset.Report.Problems {
+		if p.Problem != PROBLEM_CRC {
+			continue
+		}
+		base := strings.TrimSuffix(p.File, filepath.Ext(p.File)) + ".000"
+		if strings.EqualFold(vsi.Join(dir, base), file.SourcePath()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadCatalog reads a CATALOG.031, a file or a /vsizip/ path, and checks the
+// files it lists. It returns the entries of the files that exist and a
+// report of the problems found.
+func ReadCatalog(catalogPath string) ([]CatalogEntry, CatalogReport) {
+	report := CatalogReport{Catalog: catalogPath, Problems: make([]CatalogProblem, 0)}
+	data, err := vsi.ReadFile(catalogPath)
+	if err != nil {
+		report.add(CATALOG_FILE, PROBLEM_MISSING, "%s", err)
+		return nil, report
+	}
+	dir := vsi.Dir(catalogPath)
+	entries := make([]CatalogEntry, 0)
+	for _, entry := range readCatalogEntries(data, &report) {
+		if strings.EqualFold(filepath.Base(entry.File), CATALOG_FILE) {
+			continue
+		}
+		report.Files++
+		if entry.BaseCell() {
+			report.Cells++
+		}
+		checkFile(vsi.Join(dir, entry.File), entry, &report)
+		if report.Problem(entry.File) != PROBLEM_MISSING {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, report
+}
@@ -5,32 +5,43 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
-	"github.com/lukeroth/gdal"
-	"github.com/tburke/iso8211"
 	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+	"github.com/wdantuma/s57-tiler/s57/vsi"
 )
 
 type Layer struct {
 	Name   string
-	Bounds gdal.Envelope
+	Bounds ogr.Envelope
 }
 
 type File struct {
 	Id     string
 	Path   string
+	Source string // the encrypted cell in the exchange set of a decrypted S-63 cell
 	Layers map[string]Layer
 }
 
+// SourcePath returns the path of the cell in the exchange set
+func (file File) SourcePath() string {
+	if file.Source != "" {
+		return file.Source
+	}
+	return file.Path
+}
+
 type Dataset struct {
 	Id          string
 	Description string
 	Files       []File
+	Report      CatalogReport // problems found in the catalog
 }
 
-func getLayers(datasource gdal.DataSource) map[string]Layer {
+func getLayers(datasource ogr.DataSource) map[string]Layer {
 	layers := make(map[string]Layer, 0)
 	for i := 0; i < datasource.LayerCount(); i++ {
 		layer := datasource.LayerByIndex(i)
@@ -66,7 +77,7 @@ func (dataset Dataset) GetDatasetForTile(tile m.TileID) Dataset {
 	for _, f := range dataset.Files {
 
 		bounds := m.Bounds(tile)
-		tileEnvelope := gdal.Envelope{}
+		tileEnvelope := ogr.Envelope{}
 		tileEnvelope.SetMaxX(bounds.E)
 		tileEnvelope.SetMaxY(bounds.N)
 		tileEnvelope.SetMinX(bounds.W)
@@ -81,51 +92,170 @@ func (dataset Dataset) GetDatasetForTile(tile m.TileID) Dataset {
 	return retVal
 }
 
+// getCatalogDataset returns a dataset with the base cells listed in a
+// catalog, cells that are missing or can't be used are left out and
+// reported. Every file of the catalog is added to listed.
+func getCatalogDataset(id string, catalogPath string, s63 *S63, listed map[string]bool) Dataset {
+	entries, report := ReadCatalog(catalogPath)
+	dataset := Dataset{Id: id, Description: "", Report: report}
+	dir := vsi.Dir(catalogPath)
+	for _, entry := range entries {
+		sourcePath := vsi.Join(dir, entry.File)
+		listed[strings.ToUpper(sourcePath)] = true
+		if !entry.BaseCell() {
+			continue
+		}
+		filePath, ok := s63.open(sourcePath, entry.File, &dataset.Report)
+		if !ok {
+			continue
+		}
+		datasource, err := ogr.OpenDataSource(filePath, 0)
+		if err != nil {
+			dataset.Report.add(entry.File, PROBLEM_INVALID, "%s", err)
+			continue
+		}
+		file := File{
+			Id:     filepath.Base(filepath.Dir(sourcePath)),
+			Path:   filePath,
+			Layers: getLayers(datasource),
+		}
+		if filePath != sourcePath {
+			file.Source = sourcePath
+		}
+		datasource.Destroy()
+		dataset.Files = append(dataset.Files, file)
+	}
+	return dataset
+}
+
+// isBaseCell returns true for the file name of a S-57 base cell
+func isBaseCell(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".000")
+}
+
+// cellName returns the data set name (DSNM) of a cell without its
+// extension, "" when the cell has no DSID
+func cellName(datasource ogr.DataSource) string {
+	for i := 0; i < datasource.LayerCount(); i++ {
+		layer := datasource.LayerByIndex(i)
+		if layer.Name() != "DSID" {
+			continue
+		}
+		feature := layer.NextFeature()
+		if feature == nil {
+			return ""
+		}
+		defer feature.Destroy()
+		index := feature.FieldIndex("DSID_DSNM")
+		if index < 0 || !feature.IsFieldSet(index) {
+			return ""
+		}
+		name := strings.TrimSpace(feature.FieldAsString(index))
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return ""
+}
+
+// getCells returns a dataset with the base cells not listed in any catalog,
+// the cells get the name in their DSID as id. Cells a catalog lists but
+// rejects are not added again. S-101 cells are found here, an S-100 exchange
+// set has a CATALOG.XML instead of a CATALOG.031.
+func getCells(id string, cellPaths []string, listed map[string]bool, s63 *S63) Dataset {
+	dataset := Dataset{Id: id, Description: "Cells without a catalog", Report: CatalogReport{Problems: make([]CatalogProblem, 0)}}
+	for _, cellPath := range cellPaths {
+		if listed[strings.ToUpper(cellPath)] {
+			continue
+		}
+		filePath, ok := s63.open(cellPath, cellPath, &dataset.Report)
+		if !ok {
+			continue
+		}
+		datasource, err := ogr.OpenDataSource(filePath, 0)
+		if err != nil {
+			dataset.Report.add(cellPath, PROBLEM_INVALID, "%s", err)
+			continue
+		}
+		name := cellName(datasource)
+		if name == "" {
+			base := filepath.Base(cellPath)
+			name = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+		file := File{Id: name, Path: filePath, Layers: getLayers(datasource)}
+		if filePath != cellPath {
+			file.Source = cellPath
+		}
+		dataset.Files = append(dataset.Files, file)
+		datasource.Destroy()
+	}
+	return dataset
+}
+
+// catalogFile is a CATALOG.031 found in the input path
+type catalogFile struct {
+	id   string
+	path string
+}
+
+// getZipCatalogs adds every CATALOG.031 in a zip archive to catalogs and the
+// base cells in the archive to cellPaths, as /vsizip/ paths
+func getZipCatalogs(archive string, catalogs *[]catalogFile, cellPaths *[]string) error {
+	archive, err := filepath.Abs(archive)
+	if err != nil {
+		return err
+	}
+	members, err := vsi.Files(archive)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if isBaseCell(member) {
+			*cellPaths = append(*cellPaths, vsi.ZipPath(archive, path.Clean(member)))
+		}
+		if strings.ToUpper(path.Base(member)) != CATALOG_FILE {
+			continue
+		}
+		parts := strings.Split(member, "/")
+		id := strings.TrimSuffix(filepath.Base(archive), filepath.Ext(archive))
+		if len(parts) > 2 {
+			id = parts[len(parts)-3]
+		}
+		*catalogs = append(*catalogs, catalogFile{id: id, path: vsi.ZipPath(archive, path.Clean(member))})
+	}
+	return nil
+}
+
+// GetS57Datasets returns a dataset for every CATALOG.031 in the directory
+// tree and in zip files, base cells not listed in a catalog are returned in
+// an extra dataset named after the path
 func GetS57Datasets(path string) ([]Dataset, error) {
+	return getS57Datasets(path, nil)
+}
+
+func getS57Datasets(path string, s63 *S63) ([]Dataset, error) {
 	datasets := make([]Dataset, 0)
+	catalogs := make([]catalogFile, 0)
+	cellPaths := make([]string, 0)
 	err := filepath.WalkDir(path, func(fp string, entry fs.DirEntry, err error) error {
 		if entry != nil {
 			info, err := entry.Info()
 			if err != nil {
 				return err
 			}
-			if strings.ToUpper(info.Name()) == "CATALOG.031" {
+			if !info.IsDir() && vsi.IsZip(info.Name()) {
+				if err := getZipCatalogs(fp, &catalogs, &cellPaths); err != nil {
+					return err
+				}
+			}
+			if !info.IsDir() && isBaseCell(info.Name()) {
+				cellPaths = append(cellPaths, fp)
+			}
+			if strings.ToUpper(info.Name()) == CATALOG_FILE {
 				parts := strings.Split(fp, string(os.PathSeparator))
 				id := "test"
 				if len(parts) > 2 {
 					id = parts[len(parts)-3]
 				}
-				dataset := Dataset{Id: id, Description: ""}
-				f, err := os.Open(fp)
-				if err != nil {
-					return err
-				}
-				var l iso8211.LeadRecord
-				l.Read(f)
-				var d iso8211.DataRecord
-				d.Lead = &l
-				for d.Read(f) == nil {
-					if d.Fields[1].SubFields[5] == "BIN" {
-						fileName := fmt.Sprintf("%s", d.Fields[1].SubFields[2])
-						if strings.Contains(fileName, ".000") {
-							filePath := strings.ReplaceAll(fileName, "\\", string(os.PathSeparator))
-							filePath = filepath.Join(filepath.Dir(fp), filePath)
-							datasource := gdal.OpenDataSource(filePath, 0)
-							defer datasource.Destroy()
-							parts = strings.Split(filePath, string(os.PathSeparator))
-							file := File{
-								Id:     parts[len(parts)-2],
-								Path:   filePath,
-								Layers: getLayers(datasource),
-							}
-							dataset.Files = append(dataset.Files, file)
-						}
-
-					}
-
-				}
-				datasets = append(datasets, dataset)
-
+				catalogs = append(catalogs, catalogFile{id: id, path: fp})
 			}
 		} else {
 			return errors.New(fmt.Sprintf("Invalid path:%s", path))
@@ -136,5 +266,16 @@ func GetS57Datasets(path string) ([]Dataset, error) {
 	if err != nil {
 		return datasets, err
 	}
+	listed := make(map[string]bool)
+	for _, catalog := range catalogs {
+		datasets = append(datasets, getCatalogDataset(catalog.id, catalog.path, s63, listed))
+	}
+	id := filepath.Base(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		id = filepath.Base(abs)
+	}
+	if cells := getCells(id, cellPaths, listed, s63); len(cells.Files) > 0 || len(cells.Report.Problems) > 0 {
+		datasets = append(datasets, cells)
+	}
 	return datasets, nil
 }
@@ -0,0 +1,426 @@
+package dataset
+
+// S-63 encrypted ENC's, a cell and its updates are compressed with zip and
+// encrypted with Blowfish using a cell key. The cell keys are in the cell
+// permits, encrypted with the hardware id of the user.
+// see https://iho.int/uploads/user/pubs/standards/s-63/S-63_e1.2.0_EN_Jan2015.pdf
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/dsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wdantuma/s57-tiler/s57/vsi"
+	"golang.org/x/crypto/blowfish"
+)
+
+// S-63 problems
+const (
+	PROBLEM_PERMIT    = "permit"    // the cell has no valid cell permit
+	PROBLEM_EXPIRED   = "expired"   // the permit has expired, the cell is still used
+	PROBLEM_SIGNATURE = "signature" // the signature of the cell can't be verified
+	PROBLEM_DECRYPT   = "decrypt"   // the cell can't be decrypted with the cell keys
+)
+
+// CellPermit is a cell permit with the decrypted cell keys
+type CellPermit struct {
+	Cell   string
+	Expiry time.Time
+	Keys   [][]byte // cell keys ECK1 and ECK2
+}
+
+// S63 decrypts S-63 cells with the cell permits of a user
+type S63 struct {
+	hwId6   []byte
+	permits map[string]CellPermit
+	invalid map[string]error // cell permits that can't be used
+	saKey   *dsa.PublicKey   // nil when signatures aren't verified
+	dir     string           // directory with the decrypted cells
+}
+
+// blowfishECB encrypts or decrypts data, a multiple of 8 bytes, in ECB mode
+func blowfishECB(key []byte, data []byte, decrypt bool) ([]byte, error) {
+	cipher, err := blowfish.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%blowfish.BlockSize != 0 {
+		return nil, errors.New("data is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += blowfish.BlockSize {
+		if decrypt {
+			cipher.Decrypt(out[i:], data[i:])
+		} else {
+			cipher.Encrypt(out[i:], data[i:])
+		}
+	}
+	return out, nil
+}
+
+// parseHwId returns HW_ID6, the 5 byte hardware id followed by its first
+// byte, the key of the cell permits
+func parseHwId(hwId string) ([]byte, error) {
+	id, err := hex.DecodeString(strings.TrimSpace(hwId))
+	if err != nil || len(id) != 5 {
+		return nil, fmt.Errorf("invalid HW_ID %s, it should be 10 hex digits", hwId)
+	}
+	return append(id, id[0]), nil
+}
+
+// parseCellPermit parses the 64 character cell permit at the start of a
+// PERMIT.TXT line, the check sum is the encrypted CRC32 of the first 48
+func parseCellPermit(line string, hwId6 []byte) (CellPermit, error) {
+	permit := strings.ToUpper(strings.TrimSpace(strings.Split(line, ",")[0]))
+	if len(permit) != 64 {
+		return CellPermit{}, fmt.Errorf("invalid cell permit %s", permit)
+	}
+	crc := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE([]byte(permit[:48])))
+	check, err := blowfishECB(hwId6, append(crc, 4, 4, 4, 4), false)
+	if err != nil {
+		return CellPermit{}, err
+	}
+	if strings.ToUpper(hex.EncodeToString(check)) != permit[48:] {
+		return CellPermit{}, fmt.Errorf("cell permit %s doesn't match the HW_ID", permit[:8])
+	}
+	expiry, err := time.Parse("20060102", permit[8:16])
+	if err != nil {
+		return CellPermit{}, fmt.Errorf("invalid expiry date in cell permit %s", permit[:8])
+	}
+	result := CellPermit{Cell: permit[:8], Expiry: expiry}
+	for _, eck := range []string{permit[16:32], permit[32:48]} {
+		encrypted, err := hex.DecodeString(eck)
+		if err != nil {
+			return CellPermit{}, fmt.Errorf("invalid cell key in cell permit %s", permit[:8])
+		}
+		key, err := blowfishECB(hwId6, encrypted, true)
+		if err != nil {
+			return CellPermit{}, err
+		}
+		// 5 byte key padded with 3 bytes
+		result.Keys = append(result.Keys, key[:5])
+	}
+	return result, nil
+}
+
+// readPermits reads the cell permits in the :ENC section of a PERMIT.TXT,
+// the permits that can't be used are returned with their error
+func readPermits(path string, hwId6 []byte) (map[string]CellPermit, map[string]error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	permits := make(map[string]CellPermit)
+	invalid := make(map[string]error)
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, ":") {
+			section = strings.ToUpper(strings.Fields(line)[0])
+			continue
+		}
+		if section != ":ENC" || line == "" {
+			continue
+		}
+		permit, err := parseCellPermit(line, hwId6)
+		if err != nil {
+			if len(line) >= 8 {
+				invalid[strings.ToUpper(line[:8])] = err
+			}
+			continue
+		}
+		permits[permit.Cell] = permit
+	}
+	return permits, invalid, scanner.Err()
+}
+
+var signatureParts = regexp.MustCompile(`(?m)^// *(Signature part [RS]|BIG [pqgy]):?\s*$`)
+
+// readSignatureParts returns the hex values of a signature or public key
+// file in order of their headers, each value ends with a '.'. It also
+// returns the offset of the first BIG p header, the start of the public key.
+func readSignatureParts(text string) ([]string, []*big.Int, int, error) {
+	headers := make([]string, 0)
+	values := make([]*big.Int, 0)
+	keyStart := -1
+	matches := signatureParts.FindAllStringSubmatchIndex(text, -1)
+	for i, match := range matches {
+		header := text[match[2]:match[3]]
+		if header == "BIG p" && keyStart < 0 {
+			keyStart = match[0]
+		}
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		digits := strings.Join(strings.Fields(strings.TrimSpace(text[match[1]:end])), "")
+		v, ok := new(big.Int).SetString(strings.TrimSuffix(digits, "."), 16)
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("invalid %s", header)
+		}
+		headers = append(headers, header)
+		values = append(values, v)
+	}
+	return headers, values, keyStart, nil
+}
+
+// readDSAKey reads a DSA public key in the text format of S-63, the BIG p,
+// q, g and y values
+func readDSAKey(text string) (*dsa.PublicKey, error) {
+	headers, values, _, err := readSignatureParts(text)
+	if err != nil {
+		return nil, err
+	}
+	key := &dsa.PublicKey{}
+	for i, header := range headers {
+		switch header {
+		case "BIG p":
+			key.P = values[i]
+		case "BIG q":
+			key.Q = values[i]
+		case "BIG g":
+			key.G = values[i]
+		case "BIG y":
+			key.Y = values[i]
+		}
+	}
+	if key.P == nil || key.Q == nil || key.G == nil || key.Y == nil {
+		return nil, errors.New("incomplete DSA public key")
+	}
+	return key, nil
+}
+
+// readSAKey reads the public key of the scheme administrator, the IHO.PUB
+// text format or a X.509 certificate (IHO.CRT) in PEM or DER
+func readSAKey(path string) (*dsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := readDSAKey(string(data)); err == nil {
+		return key, nil
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a S-63 public key or X.509 certificate", path)
+	}
+	key, ok := cert.PublicKey.(*dsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't have a DSA public key", path)
+	}
+	return key, nil
+}
+
+// NewS63 reads the cell permits of PERMIT.TXT for the hardware id, when a
+// SA public key or certificate is given the signatures of the cells are
+// verified. The decrypted cells are written to a temporary directory.
+func NewS63(permitFile string, hwId string, saCertFile string) (*S63, error) {
+	hwId6, err := parseHwId(hwId)
+	if err != nil {
+		return nil, err
+	}
+	permits, invalid, err := readPermits(permitFile, hwId6)
+	if err != nil {
+		return nil, err
+	}
+	s := &S63{hwId6: hwId6, permits: permits, invalid: invalid}
+	if saCertFile != "" {
+		if s.saKey, err = readSAKey(saCertFile); err != nil {
+			return nil, err
+		}
+	}
+	if s.dir, err = os.MkdirTemp("", "s63-"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close removes the decrypted cells
+func (s *S63) Close() {
+	if s != nil {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// GetS57Datasets returns the datasets like GetS57Datasets, S-63 cells are
+// decrypted
+func (s *S63) GetS57Datasets(path string) ([]Dataset, error) {
+	return getS57Datasets(path, s)
+}
+
+// encrypted returns false for an ISO 8211 file, its leader has interchange
+// level 3 and leader id L
+func encrypted(data []byte) bool {
+	return len(data) < 7 || data[5] != '3' || data[6] != 'L'
+}
+
+// verify verifies the signature file of a cell or update, named after the
+// file with its first character replaced by S. The first signature is the
+// signature of the file by the data server, the second the signature of
+// the data server's public key by the scheme administrator.
+func (s *S63) verify(path string, data []byte) error {
+	if s.saKey == nil {
+		return nil
+	}
+	name := filepath.Base(path)
+	signatureFile := ""
+	if names, err := vsi.ReadDir(vsi.Dir(path)); err == nil {
+		for _, n := range names {
+			if strings.EqualFold(n, "S"+name[1:]) {
+				signatureFile = vsi.Join(vsi.Dir(path), n)
+			}
+		}
+	}
+	if signatureFile == "" {
+		return fmt.Errorf("no signature file for %s", name)
+	}
+	signature, err := vsi.ReadFile(signatureFile)
+	if err != nil {
+		return err
+	}
+	headers, values, keyStart, err := readSignatureParts(string(signature))
+	if err != nil {
+		return err
+	}
+	if len(headers) < 8 || keyStart < 0 || headers[0] != "Signature part R" || headers[1] != "Signature part S" ||
+		headers[2] != "Signature part R" || headers[3] != "Signature part S" {
+		return fmt.Errorf("invalid signature file %s", filepath.Base(signatureFile))
+	}
+	dsKey, err := readDSAKey(string(signature[keyStart:]))
+	if err != nil {
+		return err
+	}
+	keyHash := sha1.Sum(signature[keyStart:])
+	if !dsa.Verify(s.saKey, keyHash[:], values[2], values[3]) {
+		return errors.New("the data server certificate isn't signed by the scheme administrator")
+	}
+	fileHash := sha1.Sum(data)
+	if !dsa.Verify(dsKey, fileHash[:], values[0], values[1]) {
+		return fmt.Errorf("the signature of %s doesn't match", name)
+	}
+	return nil
+}
+
+// decrypt decrypts a cell or update with one of the cell keys and returns
+// the file in the zip it contains
+func decrypt(permit CellPermit, data []byte) ([]byte, error) {
+	for _, key := range permit.Keys {
+		decrypted, err := blowfishECB(key, data[:len(data)-len(data)%blowfish.BlockSize], true)
+		if err != nil {
+			continue
+		}
+		// the zip is padded to the block size, archive/zip ignores the padding
+		r, err := zip.NewReader(bytes.NewReader(decrypted), int64(len(decrypted)))
+		if err != nil || len(r.File) == 0 {
+			continue
+		}
+		f, err := r.File[0].Open()
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err == nil {
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("can't decrypt with the keys of cell permit %s", permit.Cell)
+}
+
+// open returns the path to open for a cell, for a S-63 cell the cell and
+// its updates are verified and decrypted to the temporary directory, without
+// permits they are refused. Signature files are skipped.
+// Problems are added to the report for file, false when the cell can't
+// be used.
+func (s *S63) open(path string, file string, report *CatalogReport) (string, bool) {
+	data, err := vsi.ReadFile(path)
+	if err != nil {
+		return path, true
+	}
+	// S-63 signature files have the same extension as the cells
+	if bytes.HasPrefix(data, []byte("//")) {
+		return path, false
+	}
+	if !encrypted(data) {
+		return path, true
+	}
+	if s == nil {
+		report.add(file, PROBLEM_PERMIT, "not an ISO 8211 file, S-63 cells need a permit file and HW_ID")
+		return path, false
+	}
+	name := filepath.Base(path)
+	cell := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	permit, ok := s.permits[cell]
+	if !ok {
+		if err, ok := s.invalid[cell]; ok {
+			report.add(file, PROBLEM_PERMIT, "%s", err)
+		} else {
+			report.add(file, PROBLEM_PERMIT, "no cell permit for %s", cell)
+		}
+		return path, false
+	}
+	if permit.Expiry.Before(time.Now()) {
+		report.add(file, PROBLEM_EXPIRED, "the cell permit for %s expired on %s", cell, permit.Expiry.Format("2006-01-02"))
+	}
+	dir := filepath.Join(s.dir, cell)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		report.add(file, PROBLEM_DECRYPT, "%s", err)
+		return path, false
+	}
+	// the base cell and its updates, an update that can't be used stops the
+	// sequence
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for n := 0; n < 1000; n++ {
+		filePath := fmt.Sprintf("%s.%03d", base, n)
+		if n > 0 {
+			if !vsi.Exists(filePath) {
+				break
+			}
+			if data, err = vsi.ReadFile(filePath); err != nil {
+				report.add(file, PROBLEM_DECRYPT, "%s", err)
+				break
+			}
+		}
+		if err := s.verify(filePath, data); err != nil {
+			report.add(file, PROBLEM_SIGNATURE, "%s", err)
+			if n == 0 {
+				return path, false
+			}
+			break
+		}
+		decrypted, err := decrypt(permit, data)
+		if err != nil {
+			report.add(file, PROBLEM_DECRYPT, "%s", err)
+			if n == 0 {
+				return path, false
+			}
+			break
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.%03d", cell, n)), decrypted, 0600); err != nil {
+			report.add(file, PROBLEM_DECRYPT, "%s", err)
+			return path, false
+		}
+	}
+	return filepath.Join(dir, cell+".000"), true
+}
@@ -0,0 +1,355 @@
+package s57
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// export formats
+const (
+	EXPORT_GEOJSON    = "geojson" // newline delimited GeoJSON features
+	EXPORT_FLATGEOBUF = "fgb"
+)
+
+var exportExtensions = map[string]string{EXPORT_GEOJSON: ".geojsonl", EXPORT_FLATGEOBUF: ".fgb"}
+
+// exportFeature is a feature with its geometry in lon/lat, clipped when
+// exporting a part of the cell
+type exportFeature struct {
+	feature GeoJSONFeature
+	fields  []fieldValue
+}
+
+// positions returns all positions of the geometry
+func (f exportFeature) positions() [][]float64 {
+	positions := make([][]float64, 0)
+	switch c := f.feature.Geometry.Coordinates.(type) {
+	case []float64:
+		positions = append(positions, c)
+	case [][]float64:
+		positions = append(positions, c...)
+	case [][][]float64:
+		for _, line := range c {
+			positions = append(positions, line...)
+		}
+	case [][][][]float64:
+		for _, polygon := range c {
+			for _, ring := range polygon {
+				positions = append(positions, ring...)
+			}
+		}
+	}
+	return positions
+}
+
+func inside(p []float64, bounds m.Extrema) bool {
+	return p[0] >= bounds.W && p[0] <= bounds.E && p[1] >= bounds.S && p[1] <= bounds.N
+}
+
+// interpolate returns the position at fraction t from a to b, z included
+func interpolate(a []float64, b []float64, t float64) []float64 {
+	p := make([]float64, len(a))
+	for i := range a {
+		p[i] = a[i] + t*(b[i]-a[i])
+	}
+	return p
+}
+
+// clipLine clips a line to the bounds with Liang-Barsky, a line leaving and
+// entering the bounds is split into several lines
+func clipLine(line [][]float64, bounds m.Extrema) [][][]float64 {
+	lines := make([][][]float64, 0)
+	current := make([][]float64, 0)
+	for i := 0; i < len(line)-1; i++ {
+		a, b := line[i], line[i+1]
+		t0, t1 := 0.0, 1.0
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		visible := true
+		for _, edge := range [][2]float64{{-dx, a[0] - bounds.W}, {dx, bounds.E - a[0]}, {-dy, a[1] - bounds.S}, {dy, bounds.N - a[1]}} {
+			p, q := edge[0], edge[1]
+			if p == 0 {
+				if q < 0 {
+					visible = false
+				}
+				continue
+			}
+			r := q / p
+			if p < 0 {
+				if r > t1 {
+					visible = false
+				} else if r > t0 {
+					t0 = r
+				}
+			} else {
+				if r < t0 {
+					visible = false
+				} else if r < t1 {
+					t1 = r
+				}
+			}
+		}
+		if !visible {
+			if len(current) > 1 {
+				lines = append(lines, current)
+			}
+			current = make([][]float64, 0)
+			continue
+		}
+		if len(current) == 0 {
+			current = append(current, interpolate(a, b, t0))
+		}
+		current = append(current, interpolate(a, b, t1))
+		if t1 < 1 {
+			lines = append(lines, current)
+			current = make([][]float64, 0)
+		}
+	}
+	if len(current) > 1 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// clipRing clips a closed ring to the bounds with Sutherland-Hodgman
+func clipRing(ring [][]float64, bounds m.Extrema) [][]float64 {
+	edges := []struct {
+		inside func(p []float64) bool
+		t      func(a []float64, b []float64) float64
+	}{
+		{func(p []float64) bool { return p[0] >= bounds.W }, func(a, b []float64) float64 { return (bounds.W - a[0]) / (b[0] - a[0]) }},
+		{func(p []float64) bool { return p[0] <= bounds.E }, func(a, b []float64) float64 { return (bounds.E - a[0]) / (b[0] - a[0]) }},
+		{func(p []float64) bool { return p[1] >= bounds.S }, func(a, b []float64) float64 { return (bounds.S - a[1]) / (b[1] - a[1]) }},
+		{func(p []float64) bool { return p[1] <= bounds.N }, func(a, b []float64) float64 { return (bounds.N - a[1]) / (b[1] - a[1]) }},
+	}
+	points := ring
+	if len(points) > 1 {
+		points = points[:len(points)-1]
+	}
+	for _, edge := range edges {
+		clipped := make([][]float64, 0, len(points))
+		for i, p := range points {
+			prev := points[(i+len(points)-1)%len(points)]
+			if edge.inside(p) {
+				if !edge.inside(prev) {
+					clipped = append(clipped, interpolate(prev, p, edge.t(prev, p)))
+				}
+				clipped = append(clipped, p)
+			} else if edge.inside(prev) {
+				clipped = append(clipped, interpolate(prev, p, edge.t(prev, p)))
+			}
+		}
+		points = clipped
+		if len(points) == 0 {
+			return nil
+		}
+	}
+	// a ring along an edge of the bounds collapses to repeated points
+	ring = make([][]float64, 0, len(points)+1)
+	area := 0.0
+	for i, p := range points {
+		next := points[(i+1)%len(points)]
+		area += p[0]*next[1] - next[0]*p[1]
+		if len(ring) == 0 || p[0] != ring[len(ring)-1][0] || p[1] != ring[len(ring)-1][1] {
+			ring = append(ring, p)
+		}
+	}
+	if len(ring) > 1 && ring[0][0] == ring[len(ring)-1][0] && ring[0][1] == ring[len(ring)-1][1] {
+		ring = ring[:len(ring)-1]
+	}
+	if len(ring) < 3 || area == 0 {
+		return nil
+	}
+	return append(ring, ring[0])
+}
+
+func clipPolygon(polygon [][][]float64, bounds m.Extrema) [][][]float64 {
+	clipped := make([][][]float64, 0)
+	for i, ring := range polygon {
+		r := clipRing(ring, bounds)
+		if r == nil {
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		clipped = append(clipped, r)
+	}
+	return clipped
+}
+
+// clipGeometry clips a GeoJSON geometry to the bounds, nil when nothing is left
+func clipGeometry(geometry *GeoJSONGeometry, bounds m.Extrema) *GeoJSONGeometry {
+	switch c := geometry.Coordinates.(type) {
+	case []float64:
+		if inside(c, bounds) {
+			return geometry
+		}
+	case [][]float64:
+		if geometry.Type == "MultiPoint" {
+			points := make([][]float64, 0)
+			for _, p := range c {
+				if inside(p, bounds) {
+					points = append(points, p)
+				}
+			}
+			if len(points) > 0 {
+				return &GeoJSONGeometry{Type: "MultiPoint", Coordinates: points}
+			}
+			return nil
+		}
+		lines := clipLine(c, bounds)
+		if len(lines) == 1 {
+			return &GeoJSONGeometry{Type: "LineString", Coordinates: lines[0]}
+		}
+		if len(lines) > 1 {
+			return &GeoJSONGeometry{Type: "MultiLineString", Coordinates: lines}
+		}
+	case [][][]float64:
+		if geometry.Type == "Polygon" {
+			if polygon := clipPolygon(c, bounds); polygon != nil {
+				return &GeoJSONGeometry{Type: "Polygon", Coordinates: polygon}
+			}
+			return nil
+		}
+		lines := make([][][]float64, 0)
+		for _, line := range c {
+			lines = append(lines, clipLine(line, bounds)...)
+		}
+		if len(lines) > 0 {
+			return &GeoJSONGeometry{Type: "MultiLineString", Coordinates: lines}
+		}
+	case [][][][]float64:
+		polygons := make([][][][]float64, 0)
+		for _, polygon := range c {
+			if p := clipPolygon(polygon, bounds); p != nil {
+				polygons = append(polygons, p)
+			}
+		}
+		if len(polygons) > 0 {
+			return &GeoJSONGeometry{Type: "MultiPolygon", Coordinates: polygons}
+		}
+	}
+	return nil
+}
+
+// toPositions converts the any typed coordinates of toGeoJSONCoordinates to
+// typed slices so they can be clipped
+func toPositions(coordinates interface{}) interface{} {
+	switch c := coordinates.(type) {
+	case []interface{}:
+		if len(c) == 0 {
+			return [][]float64{}
+		}
+		switch c[0].(type) {
+		case []float64:
+			positions := make([][]float64, len(c))
+			for i := range c {
+				positions[i] = c[i].([]float64)
+			}
+			return positions
+		case [][]float64:
+			lines := make([][][]float64, len(c))
+			for i := range c {
+				lines[i] = c[i].([][]float64)
+			}
+			return lines
+		default:
+			polygons := make([][][][]float64, len(c))
+			for i := range c {
+				polygons[i] = toPositions(c[i]).([][][]float64)
+			}
+			return polygons
+		}
+	}
+	return coordinates
+}
+
+func (s *s57Tiler) exportFeatures(file dataset.File, layerName string, bounds *m.Extrema) []exportFeature {
+	c := s.getCell(file)
+	features := c.layers[layerName]
+	if bounds != nil {
+		area := ogr.Envelope{}
+		area.SetMinX(bounds.W)
+		area.SetMinY(bounds.S)
+		area.SetMaxX(bounds.E)
+		area.SetMaxY(bounds.N)
+		features = c.query(layerName, area)
+	}
+	result := make([]exportFeature, 0)
+	for _, feature := range features {
+		if feature.derived {
+			continue
+		}
+		f := toGeoJSONFeature(feature)
+		if f.Geometry == nil {
+			continue
+		}
+		geometry := &GeoJSONGeometry{Type: f.Geometry.Type, Coordinates: toPositions(f.Geometry.Coordinates)}
+		if bounds != nil {
+			if geometry = clipGeometry(geometry, *bounds); geometry == nil {
+				continue
+			}
+		}
+		f.Geometry = geometry
+		result = append(result, exportFeature{feature: f, fields: feature.fields})
+	}
+	return result
+}
+
+func writeGeoJSONSeq(path string, features []exportFeature) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	for _, f := range features {
+		line, err := json.Marshal(f.feature)
+		if err != nil {
+			return err
+		}
+		w.Write(line)
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
+
+// Export writes every object class of a cell to <outPath>/<cell>/<class>.geojsonl
+// or .fgb, clipped to the bounds when given. It returns the number of
+// features written.
+func (s *s57Tiler) Export(outPath string, file dataset.File, format string, bounds *m.Extrema) (int, error) {
+	extension, ok := exportExtensions[format]
+	if !ok {
+		return 0, fmt.Errorf("unknown export format %s", format)
+	}
+	dir := filepath.Join(outPath, file.Id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, layerName := range sortedLayers(file) {
+		features := s.exportFeatures(file, layerName, bounds)
+		if len(features) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, layerName+extension)
+		var err error
+		if format == EXPORT_FLATGEOBUF {
+			err = writeFlatGeobuf(path, layerName, features)
+		} else {
+			err = writeGeoJSONSeq(path, features)
+		}
+		if err != nil {
+			return count, err
+		}
+		count += len(features)
+	}
+	return count, nil
+}
@@ -0,0 +1,87 @@
+package s57
+
+import (
+	"reflect"
+	"testing"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+)
+
+var clipBounds = m.Extrema{W: 0, S: 0, E: 10, N: 10}
+
+func TestClipLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line [][]float64
+		want [][][]float64
+	}{
+		{"inside", [][]float64{{1, 1}, {5, 5}, {9, 1}}, [][][]float64{{{1, 1}, {5, 5}, {9, 1}}}},
+		{"outside", [][]float64{{-5, -5}, {-1, 20}}, [][][]float64{}},
+		{"crossing", [][]float64{{-5, 5}, {15, 5}}, [][][]float64{{{0, 5}, {10, 5}}}},
+		{"leaving", [][]float64{{5, 5}, {15, 5}}, [][][]float64{{{5, 5}, {10, 5}}}},
+		{"entering", [][]float64{{5, 15}, {5, 5}, {6, 5}}, [][][]float64{{{5, 10}, {5, 5}, {6, 5}}}},
+		{"leaving and entering", [][]float64{{2, 5}, {2, 15}, {8, 15}, {8, 5}}, [][][]float64{{{2, 5}, {2, 10}}, {{8, 10}, {8, 5}}}},
+		{"on the edge", [][]float64{{0, 0}, {0, 10}}, [][][]float64{{{0, 0}, {0, 10}}}},
+		{"z interpolated", [][]float64{{5, 5, 1}, {15, 5, 3}}, [][][]float64{{{5, 5, 1}, {10, 5, 2}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := clipLine(test.line, clipBounds); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("clipped to %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClipRing(t *testing.T) {
+	tests := []struct {
+		name string
+		ring [][]float64
+		want [][]float64
+	}{
+		{"inside", [][]float64{{1, 1}, {9, 1}, {9, 9}, {1, 1}}, [][]float64{{1, 1}, {9, 1}, {9, 9}, {1, 1}}},
+		{"outside", [][]float64{{11, 11}, {19, 11}, {19, 19}, {11, 11}}, nil},
+		{"covering the bounds", [][]float64{{-5, -5}, {15, -5}, {15, 15}, {-5, 15}, {-5, -5}}, [][]float64{{0, 10}, {0, 0}, {10, 0}, {10, 10}, {0, 10}}},
+		{"overlapping a corner", [][]float64{{5, 5}, {15, 5}, {15, 15}, {5, 15}, {5, 5}}, [][]float64{{5, 10}, {5, 5}, {10, 5}, {10, 10}, {5, 10}}},
+		{"touching an edge", [][]float64{{10, 2}, {20, 2}, {20, 8}, {10, 8}, {10, 2}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := clipRing(test.ring, clipBounds)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("clipped to %v, want %v", got, test.want)
+			}
+			if got != nil && !reflect.DeepEqual(got[0], got[len(got)-1]) {
+				t.Errorf("clipped ring is not closed")
+			}
+		})
+	}
+}
+
+func TestClipGeometry(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry *GeoJSONGeometry
+		want     *GeoJSONGeometry
+	}{
+		{"point inside", &GeoJSONGeometry{Type: "Point", Coordinates: []float64{5, 5}}, &GeoJSONGeometry{Type: "Point", Coordinates: []float64{5, 5}}},
+		{"point outside", &GeoJSONGeometry{Type: "Point", Coordinates: []float64{15, 5}}, nil},
+		{"multipoint", &GeoJSONGeometry{Type: "MultiPoint", Coordinates: [][]float64{{5, 5}, {15, 5}}}, &GeoJSONGeometry{Type: "MultiPoint", Coordinates: [][]float64{{5, 5}}}},
+		{"line split in two", &GeoJSONGeometry{Type: "LineString", Coordinates: [][]float64{{2, 5}, {2, 15}, {8, 15}, {8, 5}}},
+			&GeoJSONGeometry{Type: "MultiLineString", Coordinates: [][][]float64{{{2, 5}, {2, 10}}, {{8, 10}, {8, 5}}}}},
+		{"hole outside", &GeoJSONGeometry{Type: "Polygon", Coordinates: [][][]float64{
+			{{5, 5}, {15, 5}, {15, 9}, {5, 9}, {5, 5}}, {{12, 6}, {12, 8}, {14, 8}, {12, 6}},
+		}}, &GeoJSONGeometry{Type: "Polygon", Coordinates: [][][]float64{{{5, 5}, {10, 5}, {10, 9}, {5, 9}, {5, 5}}}}},
+		{"exterior outside", &GeoJSONGeometry{Type: "Polygon", Coordinates: [][][]float64{{{11, 11}, {19, 11}, {19, 19}, {11, 11}}}}, nil},
+		{"multipolygon", &GeoJSONGeometry{Type: "MultiPolygon", Coordinates: [][][][]float64{
+			{{{1, 1}, {2, 1}, {2, 2}, {1, 1}}}, {{{11, 11}, {19, 11}, {19, 19}, {11, 11}}},
+		}}, &GeoJSONGeometry{Type: "MultiPolygon", Coordinates: [][][][]float64{{{{1, 1}, {2, 1}, {2, 2}, {1, 1}}}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := clipGeometry(test.geometry, clipBounds); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("clipped to %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package s57
+
+// Minimal FlatGeobuf writer, features without a spatial index
+// see https://flatgeobuf.org and https://github.com/flatgeobuf/flatgeobuf/tree/master/src/fbs
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+)
+
+var fgbMagic = []byte{0x66, 0x67, 0x62, 0x03, 0x66, 0x67, 0x62, 0x00}
+
+// FlatGeobuf geometry types
+const (
+	FGB_UNKNOWN         = 0
+	FGB_POINT           = 1
+	FGB_LINESTRING      = 2
+	FGB_POLYGON         = 3
+	FGB_MULTIPOINT      = 4
+	FGB_MULTILINESTRING = 5
+	FGB_MULTIPOLYGON    = 6
+)
+
+// FlatGeobuf column types
+const (
+	FGB_LONG   = 7
+	FGB_DOUBLE = 10
+	FGB_STRING = 11
+)
+
+var fgbGeometryTypes = map[string]byte{"Point": FGB_POINT, "LineString": FGB_LINESTRING, "Polygon": FGB_POLYGON,
+	"MultiPoint": FGB_MULTIPOINT, "MultiLineString": FGB_MULTILINESTRING, "MultiPolygon": FGB_MULTIPOLYGON}
+
+// fbBuilder writes a size prefixed flatbuffer front to back: a table is
+// written as its vtable followed by the inline fields, the objects it
+// references are written after it so all offsets point forward
+type fbBuilder struct {
+	buf []byte
+}
+
+// fbField is a table field, either an inline scalar or a referenced object
+type fbField struct {
+	scalar []byte
+	child  func(b *fbBuilder) int
+}
+
+func (b *fbBuilder) pad(align int) {
+	for len(b.buf)%align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) putUint32(pos int, v uint32) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], v)
+}
+
+func (b *fbBuilder) appendUint32(v uint32) {
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, v)
+}
+
+func (b *fbBuilder) table(fields []fbField) int {
+	b.pad(2)
+	vtable := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4+2*len(fields))...)
+	b.pad(4)
+	table := len(b.buf)
+	b.appendUint32(0)
+	positions := make([]int, len(fields))
+	for i, f := range fields {
+		switch {
+		case f.scalar != nil:
+			b.pad(len(f.scalar))
+			positions[i] = len(b.buf)
+			b.buf = append(b.buf, f.scalar...)
+		case f.child != nil:
+			b.pad(4)
+			positions[i] = len(b.buf)
+			b.appendUint32(0)
+		}
+	}
+	binary.LittleEndian.PutUint16(b.buf[vtable:], uint16(4+2*len(fields)))
+	binary.LittleEndian.PutUint16(b.buf[vtable+2:], uint16(len(b.buf)-table))
+	for i, position := range positions {
+		if position != 0 {
+			binary.LittleEndian.PutUint16(b.buf[vtable+4+2*i:], uint16(position-table))
+		}
+	}
+	b.putUint32(table, uint32(table-vtable))
+	for i, f := range fields {
+		if f.child != nil {
+			b.putUint32(positions[i], uint32(f.child(b)-positions[i]))
+		}
+	}
+	return table
+}
+
+func (b *fbBuilder) string(s string) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+func (b *fbBuilder) bytes(data []byte) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(data)))
+	b.buf = append(b.buf, data...)
+	return pos
+}
+
+func (b *fbBuilder) uint32s(values []uint32) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(values)))
+	for _, v := range values {
+		b.appendUint32(v)
+	}
+	return pos
+}
+
+func (b *fbBuilder) float64s(values []float64) int {
+	// the elements are 8 byte aligned, the length before them
+	b.pad(4)
+	if (len(b.buf)+4)%8 != 0 {
+		b.appendUint32(0)
+	}
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(values)))
+	for _, v := range values {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, math.Float64bits(v))
+	}
+	return pos
+}
+
+func (b *fbBuilder) tables(children []func(b *fbBuilder) int) int {
+	b.pad(4)
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(children)))
+	slots := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4*len(children))...)
+	for i, child := range children {
+		slot := slots + 4*i
+		b.putUint32(slot, uint32(child(b)-slot))
+	}
+	return pos
+}
+
+// finish returns the size prefixed buffer with the root table
+func finishBuffer(root func(b *fbBuilder) int) []byte {
+	b := &fbBuilder{buf: make([]byte, 8)}
+	b.putUint32(4, uint32(root(b)-4))
+	b.pad(4)
+	b.putUint32(0, uint32(len(b.buf)-4))
+	return b.buf
+}
+
+func scalar8(v uint8) []byte {
+	return []byte{v}
+}
+
+func scalar16(v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(nil, v)
+}
+
+func scalar32(v int32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, uint32(v))
+}
+
+func scalar64(v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, v)
+}
+
+func stringField(s string) fbField {
+	return fbField{child: func(b *fbBuilder) int { return b.string(s) }}
+}
+
+// fgbColumn is a property column of a FlatGeobuf file
+type fgbColumn struct {
+	name       string
+	columnType byte
+}
+
+// fgbGeometry is a geometry table, flat coordinates with the end of every
+// ring or line, and parts for multipolygons
+type fgbGeometry struct {
+	geomType byte
+	xy       []float64
+	z        []float64
+	ends     []uint32
+	parts    []fgbGeometry
+}
+
+func (g fgbGeometry) write(b *fbBuilder) int {
+	fields := make([]fbField, 8)
+	if len(g.ends) > 1 {
+		fields[0] = fbField{child: func(b *fbBuilder) int { return b.uint32s(g.ends) }}
+	}
+	if len(g.xy) > 0 {
+		fields[1] = fbField{child: func(b *fbBuilder) int { return b.float64s(g.xy) }}
+	}
+	if len(g.z) > 0 {
+		fields[2] = fbField{child: func(b *fbBuilder) int { return b.float64s(g.z) }}
+	}
+	fields[6] = fbField{scalar: scalar8(g.geomType)}
+	if len(g.parts) > 0 {
+		parts := make([]func(b *fbBuilder) int, len(g.parts))
+		for i := range g.parts {
+			parts[i] = g.parts[i].write
+		}
+		fields[7] = fbField{child: func(b *fbBuilder) int { return b.tables(parts) }}
+	}
+	return b.table(fields)
+}
+
+// addPositions appends GeoJSON positions to the flat coordinates
+func (g *fgbGeometry) addPositions(positions [][]float64, hasZ bool) {
+	for _, p := range positions {
+		g.xy = append(g.xy, p[0], p[1])
+		if hasZ {
+			z := 0.0
+			if len(p) > 2 {
+				z = p[2]
+			}
+			g.z = append(g.z, z)
+		}
+	}
+	g.ends = append(g.ends, uint32(len(g.xy)/2))
+}
+
+func toFgbGeometry(geometry *GeoJSONGeometry, hasZ bool) fgbGeometry {
+	g := fgbGeometry{geomType: fgbGeometryTypes[geometry.Type]}
+	switch c := geometry.Coordinates.(type) {
+	case []float64:
+		g.addPositions([][]float64{c}, hasZ)
+	case [][]float64:
+		g.addPositions(c, hasZ)
+	case [][][]float64:
+		for _, line := range c {
+			g.addPositions(line, hasZ)
+		}
+	case [][][][]float64:
+		for _, polygon := range c {
+			part := toFgbGeometry(&GeoJSONGeometry{Type: "Polygon", Coordinates: polygon}, hasZ)
+			g.parts = append(g.parts, part)
+		}
+	}
+	return g
+}
+
+// fgbProperties encodes the properties as column index followed by the value
+func fgbProperties(columns []fgbColumn, fields []fieldValue) []byte {
+	properties := make([]byte, 0)
+	for i, column := range columns {
+		for _, field := range fields {
+			if field.key != column.name {
+				continue
+			}
+			properties = binary.LittleEndian.AppendUint16(properties, uint16(i))
+			switch v := field.value.value.(type) {
+			case int64:
+				properties = binary.LittleEndian.AppendUint64(properties, uint64(v))
+			case float64:
+				properties = binary.LittleEndian.AppendUint64(properties, math.Float64bits(v))
+			default:
+				s, _ := v.(string)
+				properties = binary.LittleEndian.AppendUint32(properties, uint32(len(s)))
+				properties = append(properties, s...)
+			}
+		}
+	}
+	return properties
+}
+
+// writeFlatGeobuf writes the features of a layer to a FlatGeobuf file in WGS84
+func writeFlatGeobuf(path string, name string, features []exportFeature) error {
+	columns := make([]fgbColumn, 0)
+	seen := make(map[string]bool)
+	geometryType := -1
+	hasZ := false
+	envelope := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, f := range features {
+		for _, field := range f.fields {
+			if seen[field.key] {
+				continue
+			}
+			seen[field.key] = true
+			columnType := byte(FGB_STRING)
+			switch field.value.fieldType {
+			case VT_INT:
+				columnType = FGB_LONG
+			case VT_FLOAT:
+				columnType = FGB_DOUBLE
+			}
+			columns = append(columns, fgbColumn{name: field.key, columnType: columnType})
+		}
+		t := int(fgbGeometryTypes[f.feature.Geometry.Type])
+		if geometryType == -1 {
+			geometryType = t
+		} else if geometryType != t {
+			geometryType = FGB_UNKNOWN
+		}
+		for _, p := range f.positions() {
+			envelope[0], envelope[1] = math.Min(envelope[0], p[0]), math.Min(envelope[1], p[1])
+			envelope[2], envelope[3] = math.Max(envelope[2], p[0]), math.Max(envelope[3], p[1])
+			hasZ = hasZ || len(p) > 2
+		}
+	}
+	if geometryType == -1 {
+		geometryType = FGB_UNKNOWN
+	}
+
+	out := append([]byte{}, fgbMagic...)
+	out = append(out, finishBuffer(func(b *fbBuilder) int {
+		columnTables := make([]func(b *fbBuilder) int, len(columns))
+		for i, column := range columns {
+			column := column
+			columnTables[i] = func(b *fbBuilder) int {
+				return b.table([]fbField{stringField(column.name), {scalar: scalar8(column.columnType)}})
+			}
+		}
+		fields := make([]fbField, 11)
+		fields[0] = stringField(name)
+		if len(features) > 0 {
+			fields[1] = fbField{child: func(b *fbBuilder) int { return b.float64s(envelope) }}
+		}
+		fields[2] = fbField{scalar: scalar8(uint8(geometryType))}
+		if hasZ {
+			fields[3] = fbField{scalar: scalar8(1)}
+		}
+		fields[7] = fbField{child: func(b *fbBuilder) int { return b.tables(columnTables) }}
+		fields[8] = fbField{scalar: scalar64(uint64(len(features)))}
+		fields[9] = fbField{scalar: scalar16(0)} // no spatial index
+		fields[10] = fbField{child: func(b *fbBuilder) int {
+			return b.table([]fbField{stringField("EPSG"), {scalar: scalar32(4326)}})
+		}}
+		return b.table(fields)
+	})...)
+
+	for _, f := range features {
+		geometry := toFgbGeometry(f.feature.Geometry, hasZ)
+		properties := fgbProperties(columns, f.fields)
+		out = append(out, finishBuffer(func(b *fbBuilder) int {
+			return b.table([]fbField{
+				{child: geometry.write},
+				{child: func(b *fbBuilder) int { return b.bytes(properties) }},
+			})
+		})...)
+	}
+	return os.WriteFile(path, out, 0644)
+}
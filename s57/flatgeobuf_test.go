@@ -0,0 +1,272 @@
+package s57
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fbTable reads a table of a flatbuffer written by fbBuilder
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+func fbUint32(buf []byte, pos int) int {
+	return int(binary.LittleEndian.Uint32(buf[pos:]))
+}
+
+// readBuffer returns the root table of the size prefixed flatbuffer at the
+// start of data and the data after it
+func readBuffer(t *testing.T, data []byte) (fbTable, []byte) {
+	t.Helper()
+	if len(data) < 8 {
+		t.Fatalf("flatbuffer of %d bytes", len(data))
+	}
+	size := fbUint32(data, 0)
+	if 4+size > len(data) {
+		t.Fatalf("flatbuffer size %d exceeds the %d bytes left", size, len(data)-4)
+	}
+	buf := data[4 : 4+size]
+	return fbTable{buf: buf, pos: fbUint32(buf, 0)}, data[4+size:]
+}
+
+// field returns the position of field i, 0 when it is absent
+func (t fbTable) field(i int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	if 4+2*i >= int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(t.buf[vtable+4+2*i:]))
+	if offset == 0 {
+		return 0
+	}
+	return t.pos + offset
+}
+
+func (t fbTable) uint8(i int) uint8 {
+	if pos := t.field(i); pos != 0 {
+		return t.buf[pos]
+	}
+	return 0
+}
+
+func (t fbTable) uint64(i int) uint64 {
+	if pos := t.field(i); pos != 0 {
+		return binary.LittleEndian.Uint64(t.buf[pos:])
+	}
+	return 0
+}
+
+// vector returns the position of the first element and the length of a vector field
+func (t fbTable) vector(i int) (int, int) {
+	pos := t.field(i)
+	if pos == 0 {
+		return 0, 0
+	}
+	pos += fbUint32(t.buf, pos)
+	return pos + 4, fbUint32(t.buf, pos)
+}
+
+func (t fbTable) string(i int) string {
+	pos, n := t.vector(i)
+	return string(t.buf[pos : pos+n])
+}
+
+func (t fbTable) bytes(i int) []byte {
+	pos, n := t.vector(i)
+	return t.buf[pos : pos+n]
+}
+
+func (t fbTable) float64s(i int) []float64 {
+	pos, n := t.vector(i)
+	// aligned in the buffer with its size prefix
+	if (pos+4)%8 != 0 {
+		panic("unaligned float64 vector")
+	}
+	values := make([]float64, n)
+	for j := range values {
+		values[j] = math.Float64frombits(binary.LittleEndian.Uint64(t.buf[pos+8*j:]))
+	}
+	return values
+}
+
+func (t fbTable) uint32s(i int) []uint32 {
+	pos, n := t.vector(i)
+	values := make([]uint32, n)
+	for j := range values {
+		values[j] = binary.LittleEndian.Uint32(t.buf[pos+4*j:])
+	}
+	return values
+}
+
+func (t fbTable) table(i int) fbTable {
+	pos := t.field(i)
+	return fbTable{buf: t.buf, pos: pos + fbUint32(t.buf, pos)}
+}
+
+func (t fbTable) tables(i int) []fbTable {
+	pos, n := t.vector(i)
+	tables := make([]fbTable, n)
+	for j := range tables {
+		slot := pos + 4*j
+		tables[j] = fbTable{buf: t.buf, pos: slot + fbUint32(t.buf, slot)}
+	}
+	return tables
+}
+
+func exportTestFeature(geometry *GeoJSONGeometry, fields ...fieldValue) exportFeature {
+	return exportFeature{feature: GeoJSONFeature{Type: "Feature", Geometry: geometry}, fields: fields}
+}
+
+func TestWriteFlatGeobuf(t *testing.T) {
+	polygon := [][][]float64{
+		{{4, 52}, {5, 52}, {5, 53}, {4, 53}, {4, 52}},
+		{{4.2, 52.2}, {4.2, 52.8}, {4.8, 52.8}, {4.2, 52.2}},
+	}
+	features := []exportFeature{
+		exportTestFeature(&GeoJSONGeometry{Type: "Polygon", Coordinates: polygon},
+			fieldValue{key: "OBJNAM", value: Value{fieldType: VT_STRING, value: "Noordzee"}},
+			fieldValue{key: "DRVAL1", value: Value{fieldType: VT_FLOAT, value: 5.5}}),
+		exportTestFeature(&GeoJSONGeometry{Type: "Polygon", Coordinates: [][][]float64{{{3, 51}, {3.5, 51}, {3.5, 51.5}, {3, 51}}}},
+			fieldValue{key: "SCAMIN", value: Value{fieldType: VT_INT, value: int64(22000)}}),
+	}
+	path := filepath.Join(t.TempDir(), "DEPARE.fgb")
+	if err := writeFlatGeobuf(path, "DEPARE", features); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, fgbMagic) {
+		t.Fatalf("magic bytes % x", data[:8])
+	}
+
+	header, data := readBuffer(t, data[len(fgbMagic):])
+	if name := header.string(0); name != "DEPARE" {
+		t.Errorf("name %s, want DEPARE", name)
+	}
+	if envelope := header.float64s(1); !reflect.DeepEqual(envelope, []float64{3, 51, 5, 53}) {
+		t.Errorf("envelope %v", envelope)
+	}
+	if geometryType := header.uint8(2); geometryType != FGB_POLYGON {
+		t.Errorf("geometry type %d, want %d", geometryType, FGB_POLYGON)
+	}
+	if hasZ := header.uint8(3); hasZ != 0 {
+		t.Errorf("has z without z coordinates")
+	}
+	columns := make([]fgbColumn, 0)
+	for _, column := range header.tables(7) {
+		columns = append(columns, fgbColumn{name: column.string(0), columnType: column.uint8(1)})
+	}
+	wantColumns := []fgbColumn{{"OBJNAM", FGB_STRING}, {"DRVAL1", FGB_DOUBLE}, {"SCAMIN", FGB_LONG}}
+	if !reflect.DeepEqual(columns, wantColumns) {
+		t.Errorf("columns %v, want %v", columns, wantColumns)
+	}
+	if count := header.uint64(8); count != 2 {
+		t.Errorf("features count %d, want 2", count)
+	}
+	if code := header.table(10).uint64(1) & 0xffffffff; code != 4326 {
+		t.Errorf("crs code %d, want 4326", code)
+	}
+
+	feature, data := readBuffer(t, data)
+	geometry := feature.table(0)
+	if geometryType := geometry.uint8(6); geometryType != FGB_POLYGON {
+		t.Errorf("feature geometry type %d, want %d", geometryType, FGB_POLYGON)
+	}
+	if ends := geometry.uint32s(0); !reflect.DeepEqual(ends, []uint32{5, 9}) {
+		t.Errorf("ring ends %v, want [5 9]", ends)
+	}
+	wantXY := make([]float64, 0)
+	for _, ring := range polygon {
+		for _, p := range ring {
+			wantXY = append(wantXY, p...)
+		}
+	}
+	if xy := geometry.float64s(1); !reflect.DeepEqual(xy, wantXY) {
+		t.Errorf("coordinates %v, want %v", xy, wantXY)
+	}
+	properties := feature.bytes(1)
+	if column := binary.LittleEndian.Uint16(properties); column != 0 {
+		t.Fatalf("first property of column %d, want 0", column)
+	}
+	length := int(binary.LittleEndian.Uint32(properties[2:]))
+	if name := string(properties[6 : 6+length]); name != "Noordzee" {
+		t.Errorf("OBJNAM %s, want Noordzee", name)
+	}
+	properties = properties[6+length:]
+	if column := binary.LittleEndian.Uint16(properties); column != 1 {
+		t.Fatalf("second property of column %d, want 1", column)
+	}
+	if depth := math.Float64frombits(binary.LittleEndian.Uint64(properties[2:])); depth != 5.5 {
+		t.Errorf("DRVAL1 %f, want 5.5", depth)
+	}
+
+	feature, data = readBuffer(t, data)
+	if ends := feature.table(0).uint32s(0); len(ends) != 0 {
+		t.Errorf("ring ends %v for a single ring", ends)
+	}
+	properties = feature.bytes(1)
+	if column := binary.LittleEndian.Uint16(properties); column != 2 || binary.LittleEndian.Uint64(properties[2:]) != 22000 {
+		t.Errorf("SCAMIN property % x", properties)
+	}
+	if len(data) != 0 {
+		t.Errorf("%d bytes after the last feature", len(data))
+	}
+}
+
+func TestWriteFlatGeobufMultiPolygon(t *testing.T) {
+	features := []exportFeature{
+		exportTestFeature(&GeoJSONGeometry{Type: "MultiPolygon", Coordinates: [][][][]float64{
+			{{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 0, 1}}},
+			{{{2, 0}, {3, 0}, {3, 1}, {2, 0}}},
+		}}),
+		exportTestFeature(&GeoJSONGeometry{Type: "Point", Coordinates: []float64{5, 5}}),
+	}
+	path := filepath.Join(t.TempDir(), "mixed.fgb")
+	if err := writeFlatGeobuf(path, "mixed", features); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, data := readBuffer(t, data[len(fgbMagic):])
+	if geometryType := header.uint8(2); geometryType != FGB_UNKNOWN {
+		t.Errorf("geometry type %d for mixed geometries, want %d", geometryType, FGB_UNKNOWN)
+	}
+	if hasZ := header.uint8(3); hasZ != 1 {
+		t.Errorf("no z with a z coordinate")
+	}
+	if columns := header.tables(7); len(columns) != 0 {
+		t.Errorf("%d columns without fields", len(columns))
+	}
+
+	feature, data := readBuffer(t, data)
+	geometry := feature.table(0)
+	parts := geometry.tables(7)
+	if geometry.uint8(6) != FGB_MULTIPOLYGON || len(parts) != 2 {
+		t.Fatalf("geometry type %d with %d parts, want %d with 2", geometry.uint8(6), len(parts), FGB_MULTIPOLYGON)
+	}
+	if xy := parts[1].float64s(1); !reflect.DeepEqual(xy, []float64{2, 0, 3, 0, 3, 1, 2, 0}) {
+		t.Errorf("second part coordinates %v", xy)
+	}
+	if z := parts[1].float64s(2); !reflect.DeepEqual(z, []float64{0, 0, 0, 0}) {
+		t.Errorf("second part z %v, want zeros", z)
+	}
+	if z := parts[0].float64s(2); !reflect.DeepEqual(z, []float64{1, 1, 1, 1}) {
+		t.Errorf("first part z %v", z)
+	}
+
+	feature, _ = readBuffer(t, data)
+	geometry = feature.table(0)
+	if xy := geometry.float64s(1); geometry.uint8(6) != FGB_POINT || !reflect.DeepEqual(xy, []float64{5, 5}) {
+		t.Errorf("point type %d at %v", geometry.uint8(6), xy)
+	}
+}
@@ -0,0 +1,127 @@
+package s57
+
+import (
+	"strings"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Id         uint64                 `json:"id,omitempty"`
+	Geometry   *GeoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+func NewFeatureCollection() GeoJSONFeatureCollection {
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]GeoJSONFeature, 0)}
+}
+
+func toGeoJSONPosition(geometry *ogr.Geometry, index int) []float64 {
+	x, y, z := geometry.Point(index)
+	switch geometry.Type() {
+	case ogr.GT_Point25D, ogr.GT_MultiPoint25D:
+		return []float64{x, y, z}
+	}
+	return []float64{x, y}
+}
+
+func toGeoJSONPositions(geometry *ogr.Geometry) [][]float64 {
+	positions := make([][]float64, geometry.PointCount())
+	for i := range positions {
+		positions[i] = toGeoJSONPosition(geometry, i)
+	}
+	return positions
+}
+
+func toGeoJSONCoordinates(geometry *ogr.Geometry) (string, interface{}) {
+	switch geometry.Type() {
+	case ogr.GT_Point, ogr.GT_Point25D:
+		return "Point", toGeoJSONPosition(geometry, 0)
+	case ogr.GT_LineString:
+		return "LineString", toGeoJSONPositions(geometry)
+	}
+	parts := make([]interface{}, geometry.GeometryCount())
+	for i := range parts {
+		part := geometry.Geometry(i)
+		if part.GeometryCount() > 0 {
+			_, parts[i] = toGeoJSONCoordinates(&part)
+		} else if part.Type() == ogr.GT_Point || part.Type() == ogr.GT_Point25D {
+			parts[i] = toGeoJSONPosition(&part, 0)
+		} else {
+			parts[i] = toGeoJSONPositions(&part)
+		}
+	}
+	switch geometry.Type() {
+	case ogr.GT_Polygon:
+		return "Polygon", parts
+	case ogr.GT_MultiPoint, ogr.GT_MultiPoint25D:
+		return "MultiPoint", parts
+	case ogr.GT_MultiLineString:
+		return "MultiLineString", parts
+	case ogr.GT_MultiPolygon:
+		return "MultiPolygon", parts
+	}
+	return "", nil
+}
+
+// toGeoJSONGeometry converts a lon/lat geometry, nil for empty or unsupported
+// geometries
+func toGeoJSONGeometry(geometry *ogr.Geometry) *GeoJSONGeometry {
+	if geometry.IsEmpty() {
+		return nil
+	}
+	geomType, coordinates := toGeoJSONCoordinates(geometry)
+	if geomType == "" {
+		return nil
+	}
+	return &GeoJSONGeometry{Type: geomType, Coordinates: coordinates}
+}
+
+// projectedToGeoJSON converts projected rings back to lon/lat
+func projectedToGeoJSON(geometry tileGeometry) [][][]float64 {
+	rings := make([][][]float64, len(geometry.parts))
+	for i, part := range geometry.parts {
+		rings[i] = make([][]float64, len(part))
+		for j, p := range part {
+			lon, lat := m.LngLat(p.x, p.y)
+			rings[i][j] = []float64{lon, lat}
+		}
+	}
+	return rings
+}
+
+// toGeoJSONFeature converts a feature of the cell, the properties are all
+// attributes of the feature plus its layer, list attributes become arrays
+func toGeoJSONFeature(feature *cellFeature) GeoJSONFeature {
+	properties := make(map[string]interface{})
+	properties["layer"] = feature.layer
+	for _, field := range feature.fields {
+		value := field.value.value
+		if field.list {
+			value = strings.Split(value.(string), ",")
+		}
+		properties[field.key] = value
+	}
+	if feature.derived && feature.geomType == ogr.GT_Point {
+		// derived features have no OGR geometry
+		geometry := &GeoJSONGeometry{Type: "Point", Coordinates: projectedToGeoJSON(feature.projected)[0][0]}
+		return GeoJSONFeature{Type: "Feature", Id: feature.id, Geometry: geometry, Properties: properties}
+	}
+	if feature.derived {
+		geometry := &GeoJSONGeometry{Type: "Polygon", Coordinates: projectedToGeoJSON(feature.projected)}
+		return GeoJSONFeature{Type: "Feature", Geometry: geometry, Properties: properties}
+	}
+	return GeoJSONFeature{Type: "Feature", Id: feature.id, Geometry: toGeoJSONGeometry(&feature.geometry), Properties: properties}
+}
@@ -0,0 +1,216 @@
+package s57
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// layer with a label point per named area and line, generated with the Labels option
+const LABEL_LAYER = "labels"
+
+// label languages, the international name is OBJNAM and the national one NOBJNM
+const (
+	LABEL_INTERNATIONAL = "international"
+	LABEL_NATIONAL      = "national"
+)
+
+// named areas labeled at their pole of inaccessibility
+var labelAreaClasses = []string{"SEAARE", "LNDRGN", "ACHARE", "BUAARE"}
+
+// polygonDistance returns the signed distance from a point to the rings of a
+// polygon, positive inside
+func polygonDistance(p xy, rings [][]xy) float64 {
+	inside := false
+	distance := math.Inf(1)
+	for _, ring := range rings {
+		if pointInRing(p, ring) {
+			inside = !inside
+		}
+		for i := 0; i < len(ring)-1; i++ {
+			distance = math.Min(distance, segmentDistance(p, ring[i], ring[i+1]))
+		}
+	}
+	if !inside {
+		return -distance
+	}
+	return distance
+}
+
+// labelCell is a square of the polylabel search, max is the best distance
+// any point in the square can have
+type labelCell struct {
+	center   xy
+	half     float64
+	distance float64
+	max      float64
+}
+
+func newLabelCell(center xy, half float64, rings [][]xy) labelCell {
+	d := polygonDistance(center, rings)
+	return labelCell{center: center, half: half, distance: d, max: d + half*math.Sqrt2}
+}
+
+type labelCellHeap []labelCell
+
+func (h labelCellHeap) Len() int            { return len(h) }
+func (h labelCellHeap) Less(i, j int) bool  { return h[i].max > h[j].max }
+func (h labelCellHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *labelCellHeap) Push(x interface{}) { *h = append(*h, x.(labelCell)) }
+func (h *labelCellHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	*h = old[:n-1]
+	return c
+}
+
+// poleOfInaccessibility returns the point inside the polygon farthest from
+// its outline (the polylabel algorithm), to a precision of a thousandth of
+// the polygon size
+func poleOfInaccessibility(rings [][]xy) xy {
+	if len(rings) == 0 || len(rings[0]) == 0 {
+		return xy{}
+	}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range rings[0] {
+		minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+		maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+	}
+	if math.Min(maxX-minX, maxY-minY) == 0 {
+		return rings[0][0]
+	}
+	size := math.Max(maxX-minX, maxY-minY)
+	precision := size / 1000
+
+	// one cell covering the envelope, a grid of cells the size of the short
+	// side has too many cells for long narrow areas like fairways and rivers
+	cells := &labelCellHeap{}
+	center := xy{x: (minX + maxX) / 2, y: (minY + maxY) / 2}
+	heap.Push(cells, newLabelCell(center, size/2, rings))
+	// start with the centroid of the envelope
+	best := newLabelCell(center, 0, rings)
+	for cells.Len() > 0 {
+		c := heap.Pop(cells).(labelCell)
+		if c.distance > best.distance {
+			best = c
+		}
+		if c.max-best.distance <= precision {
+			continue
+		}
+		half := c.half / 2
+		heap.Push(cells, newLabelCell(xy{x: c.center.x - half, y: c.center.y - half}, half, rings))
+		heap.Push(cells, newLabelCell(xy{x: c.center.x + half, y: c.center.y - half}, half, rings))
+		heap.Push(cells, newLabelCell(xy{x: c.center.x - half, y: c.center.y + half}, half, rings))
+		heap.Push(cells, newLabelCell(xy{x: c.center.x + half, y: c.center.y + half}, half, rings))
+	}
+	return best.center
+}
+
+// lineMidpoint returns the point halfway along a line
+func lineMidpoint(points []xy) xy {
+	length := 0.0
+	for i := 0; i < len(points)-1; i++ {
+		length += math.Hypot(points[i+1].x-points[i].x, points[i+1].y-points[i].y)
+	}
+	remaining := length / 2
+	for i := 0; i < len(points)-1; i++ {
+		d := math.Hypot(points[i+1].x-points[i].x, points[i+1].y-points[i].y)
+		if d > 0 && remaining <= d {
+			t := remaining / d
+			return xy{x: points[i].x + t*(points[i+1].x-points[i].x), y: points[i].y + t*(points[i+1].y-points[i].y)}
+		}
+		remaining -= d
+	}
+	return points[len(points)-1]
+}
+
+// labelPoint returns the projected position to label the feature at: the
+// point itself, the middle of a line or the pole of inaccessibility of an
+// area. It is computed once per feature.
+func (feature *cellFeature) labelPoint() xy {
+	if feature.label != nil {
+		return *feature.label
+	}
+	var p xy
+	if len(feature.projected.parts) > 0 {
+		switch feature.geomType {
+		case ogr.GT_LineString:
+			p = lineMidpoint(feature.projected.parts[0])
+		case ogr.GT_Polygon:
+			p = poleOfInaccessibility(feature.projected.parts)
+		default:
+			p = feature.projected.parts[0][0]
+		}
+	}
+	feature.label = &p
+	return p
+}
+
+// name returns the name of the feature in the label language, or in the
+// other language when it has no name in that one
+func (feature *cellFeature) name(labelLanguage string) string {
+	objnam := feature.stringValue("OBJNAM")
+	nobjnm := feature.stringValue("NOBJNM")
+	if labelLanguage == LABEL_NATIONAL && nobjnm != "" || objnam == "" {
+		return nobjnm
+	}
+	return objnam
+}
+
+// addNames adds a name attribute in the label language to every named feature
+func (s *s57Tiler) addNames(c *cell) {
+	for _, features := range c.layers {
+		for _, feature := range features {
+			if name := feature.name(s.options.LabelLanguage); name != "" && !feature.derived {
+				feature.fields = append(feature.fields, fieldValue{key: "name", value: Value{fieldType: VT_STRING, value: name}})
+			}
+		}
+	}
+}
+
+func labeled(feature *cellFeature) bool {
+	if feature.derived || feature.name("") == "" || len(feature.projected.parts) == 0 {
+		return false
+	}
+	switch feature.geomType {
+	case ogr.GT_LineString:
+		return true
+	case ogr.GT_Polygon:
+		for _, class := range labelAreaClasses {
+			if feature.layer == class {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addLabels adds a point layer with the label position, name and class of
+// every named area of the label classes and every named line
+func (s *s57Tiler) addLabels(c *cell, file dataset.File) {
+	features := make([]*cellFeature, 0)
+	for _, layerName := range sortedLayers(file) {
+		for _, feature := range c.layers[layerName] {
+			if !labeled(feature) {
+				continue
+			}
+			p := feature.labelPoint()
+			label := &cellFeature{id: feature.id, layer: LABEL_LAYER, derived: true, geomType: ogr.GT_Point, simplified: make(map[uint64]tileGeometry),
+				scamin: feature.scamin, scamax: feature.scamax}
+			label.fields = append(label.fields, fieldValue{key: "name", value: Value{fieldType: VT_STRING, value: feature.name(s.options.LabelLanguage)}})
+			label.fields = append(label.fields, fieldValue{key: "class", value: Value{fieldType: VT_STRING, value: layerName}})
+			label.projected.parts = [][]xy{{p}}
+			lon, lat := m.LngLat(p.x, p.y)
+			label.envelope.SetMinX(lon)
+			label.envelope.SetMinY(lat)
+			label.envelope.SetMaxX(lon)
+			label.envelope.SetMaxY(lat)
+			features = append(features, label)
+		}
+	}
+	addDerivedLayer(c, file, LABEL_LAYER, features)
+}
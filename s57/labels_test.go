@@ -0,0 +1,41 @@
+package s57
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPoleOfInaccessibility(t *testing.T) {
+	tests := []struct {
+		name  string
+		rings [][]xy
+		want  xy
+	}{
+		{"square", [][]xy{rectangle(0, 0, 4, 4)}, xy{2, 2}},
+		{"long narrow area", [][]xy{rectangle(0, 0, 10000, 1)}, xy{5000, 0.5}},
+		{"L-shape", [][]xy{{{0, 0}, {10, 0}, {10, 2}, {2, 2}, {2, 10}, {0, 10}, {0, 0}}}, xy{1, 1}},
+		{"square with a hole", [][]xy{rectangle(0, 0, 10, 10), reversePoints(rectangle(2, 2, 8, 8))}, xy{1, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := poleOfInaccessibility(test.rings)
+			best := polygonDistance(test.want, test.rings)
+			distance := polygonDistance(got, test.rings)
+			precision := 0.0
+			for _, p := range test.rings[0] {
+				precision = math.Max(precision, math.Max(p.x, p.y)/1000)
+			}
+			if distance <= 0 || best-distance > precision {
+				t.Errorf("label at %v with distance %f, want distance %f", got, distance, best)
+			}
+		})
+	}
+}
+
+// a long narrow area starts with one cell, not a cell per square of its width
+func BenchmarkPoleOfInaccessibility(b *testing.B) {
+	rings := [][]xy{rectangle(0, 0, 100000, 1)}
+	for n := 0; n < b.N; n++ {
+		poleOfInaccessibility(rings)
+	}
+}
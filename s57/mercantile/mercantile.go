@@ -9,6 +9,8 @@ import (
 	"strings"
 )
 
+const EARTH_RADIUS = 6378137.0
+
 // Extrema structure (Bounding Box)
 type Extrema struct {
 	W float64
@@ -39,6 +41,28 @@ func Ul(tileid TileID) Point {
 	return Point{lon_deg, lat_deg}
 }
 
+// Returns the Spherical Mercator (x, y) in meters of a (lon, lat).
+func XY(lng float64, lat float64) (float64, float64) {
+	x := EARTH_RADIUS * lng * math.Pi / 180.0
+	var y float64
+	switch {
+	case lat <= -90:
+		y = math.Inf(-1)
+	case lat >= 90:
+		y = math.Inf(1)
+	default:
+		y = EARTH_RADIUS * math.Log(math.Tan(math.Pi*0.25+0.5*lat*math.Pi/180.0))
+	}
+	return x, y
+}
+
+// Returns the (lon, lat) of a Spherical Mercator (x, y) in meters.
+func LngLat(x float64, y float64) (float64, float64) {
+	lng := x * 180.0 / math.Pi / EARTH_RADIUS
+	lat := (math.Pi*0.5 - 2.0*math.Atan(math.Exp(-y/EARTH_RADIUS))) * 180.0 / math.Pi
+	return lng, lat
+}
+
 // Returns the (lon, lat) bounding box of a tile.
 func Bounds(tileid TileID) Extrema {
 	a := Ul(tileid)
@@ -0,0 +1,72 @@
+//go:build !purego
+
+package ogr
+
+// OGR types backed by GDAL, the default
+
+import (
+	"fmt"
+
+	"github.com/lukeroth/gdal"
+	"github.com/wdantuma/s57-tiler/s57/reader"
+)
+
+type (
+	DataSource      = gdal.DataSource
+	Layer           = gdal.Layer
+	Feature         = gdal.Feature
+	FieldDefinition = gdal.FieldDefinition
+	FieldType       = gdal.FieldType
+	Geometry        = gdal.Geometry
+	GeometryType    = gdal.GeometryType
+	Envelope        = gdal.Envelope
+)
+
+const (
+	GT_Point           = gdal.GT_Point
+	GT_LineString      = gdal.GT_LineString
+	GT_Polygon         = gdal.GT_Polygon
+	GT_MultiPoint      = gdal.GT_MultiPoint
+	GT_MultiLineString = gdal.GT_MultiLineString
+	GT_MultiPolygon    = gdal.GT_MultiPolygon
+	GT_Point25D        = gdal.GT_Point25D
+	GT_MultiPoint25D   = gdal.GT_MultiPoint25D
+
+	FT_Integer    = gdal.FT_Integer
+	FT_Real       = gdal.FT_Real
+	FT_String     = gdal.FT_String
+	FT_StringList = gdal.FT_StringList
+)
+
+func RegisterS57() error {
+	driver, err := gdal.GetDriverByName("S57")
+	if err != nil {
+		return err
+	}
+	driver.Register()
+	return nil
+}
+
+// Inland ENC (IENC) cells use object classes and attributes that are not in
+// the S-57 catalogue, GDAL only reads them with the Inland_Waterways profile
+// see https://gdal.org/drivers/vector/s57.html
+const INLAND_PROFILE = "Inland_Waterways"
+
+// OpenDataSource opens a S-57 cell with GDAL, S-101 cells with the pure Go
+// reader. Inland ENC cells are opened with the Inland ENC object catalogue
+// unless S57_PROFILE is set, GDAL loads the catalogue when the first cell is
+// opened.
+func OpenDataSource(name string, update int) (DataSource, error) {
+	if reader.IsS101(name) {
+		return openS101(name)
+	}
+	if gdal.CPLGetConfigOption("S57_PROFILE", "") == "" && reader.IsInland(name) {
+		gdal.CPLSetConfigOption("S57_PROFILE", INLAND_PROFILE)
+		defer gdal.CPLSetConfigOption("S57_PROFILE", "")
+	}
+	ds, ok := gdal.OGRDriverByName("S57").Open(name, update)
+	if !ok {
+		return ds, fmt.Errorf("%s can't be opened as a S-57 cell", name)
+	}
+	return ds, nil
+}
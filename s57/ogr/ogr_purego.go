@@ -0,0 +1,45 @@
+//go:build purego
+
+package ogr
+
+// OGR types backed by the pure Go S-57 reader, build with -tags purego to
+// drop the cgo GDAL dependency
+
+import (
+	"github.com/wdantuma/s57-tiler/s57/reader"
+)
+
+type (
+	DataSource      = reader.DataSource
+	Layer           = reader.Layer
+	Feature         = reader.Feature
+	FieldDefinition = reader.FieldDefinition
+	FieldType       = reader.FieldType
+	Geometry        = reader.Geometry
+	GeometryType    = reader.GeometryType
+	Envelope        = reader.Envelope
+)
+
+const (
+	GT_Point           = reader.GT_Point
+	GT_LineString      = reader.GT_LineString
+	GT_Polygon         = reader.GT_Polygon
+	GT_MultiPoint      = reader.GT_MultiPoint
+	GT_MultiLineString = reader.GT_MultiLineString
+	GT_MultiPolygon    = reader.GT_MultiPolygon
+	GT_Point25D        = reader.GT_Point25D
+	GT_MultiPoint25D   = reader.GT_MultiPoint25D
+
+	FT_Integer    = reader.FT_Integer
+	FT_Real       = reader.FT_Real
+	FT_String     = reader.FT_String
+	FT_StringList = reader.FT_StringList
+)
+
+func RegisterS57() error {
+	return nil
+}
+
+func OpenDataSource(name string, update int) (DataSource, error) {
+	return reader.Open(name)
+}
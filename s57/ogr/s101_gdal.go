@@ -0,0 +1,70 @@
+//go:build !purego
+
+package ogr
+
+// GDAL has no S-101 driver, S-101 cells are read with the pure Go reader and
+// copied to a GDAL memory data source
+
+import (
+	"fmt"
+
+	"github.com/lukeroth/gdal"
+	"github.com/wdantuma/s57-tiler/s57/reader"
+)
+
+func openS101(name string) (DataSource, error) {
+	source, err := reader.OpenS101(name)
+	if err != nil {
+		return DataSource{}, err
+	}
+	ds, ok := gdal.OGRDriverByName("Memory").Create(name, nil)
+	if !ok {
+		return DataSource{}, fmt.Errorf("can't create a memory data source")
+	}
+	srs := gdal.CreateSpatialReference("")
+	srs.FromEPSG(4326)
+	defer srs.Destroy()
+	for i := 0; i < source.LayerCount(); i++ {
+		sourceLayer := source.LayerByIndex(i)
+		layer := ds.CreateLayer(sourceLayer.Name(), srs, gdal.GT_Unknown, nil)
+		created := false
+		for f := sourceLayer.NextFeature(); f != nil; f = sourceLayer.NextFeature() {
+			// all features of a layer have the same fields
+			if !created {
+				for j := 0; j < f.FieldCount(); j++ {
+					fd := gdal.CreateFieldDefinition(f.FieldDefinition(j).Name(), gdal.FieldType(f.FieldDefinition(j).Type()))
+					layer.CreateField(fd, true)
+					fd.Destroy()
+				}
+				created = true
+			}
+			feature := layer.Definition().Create()
+			feature.SetFID(f.FID())
+			for j := 0; j < f.FieldCount(); j++ {
+				if !f.IsFieldSet(j) {
+					continue
+				}
+				switch f.FieldDefinition(j).Type() {
+				case reader.FT_Integer:
+					feature.SetFieldInteger64(j, f.FieldAsInteger64(j))
+				case reader.FT_Real:
+					feature.SetFieldFloat64(j, f.FieldAsFloat64(j))
+				case reader.FT_StringList:
+					feature.SetFieldStringList(j, f.FieldAsStringList(j))
+				default:
+					feature.SetFieldString(j, f.FieldAsString(j))
+				}
+			}
+			if geometry := f.Geometry(); !geometry.IsEmpty() {
+				if wkt, err := geometry.ToWKT(); err == nil {
+					if g, err := gdal.CreateFromWKT(wkt, srs); err == nil {
+						feature.SetGeometryDirectly(g)
+					}
+				}
+			}
+			layer.Create(feature)
+			feature.Destroy()
+		}
+	}
+	return ds, nil
+}
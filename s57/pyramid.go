@@ -0,0 +1,124 @@
+package s57
+
+import (
+	"math"
+	"sort"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// latitude limits of the spherical mercator tiles
+const MAX_LATITUDE = 85.0511287798
+
+// tileBuffer is the buffer around a tile in degrees, a quarter of the tile width
+func tileBuffer(zoom uint64) float64 {
+	return 360 / math.Pow(2, float64(zoom)) / 4
+}
+
+// simplifiedGeometry returns the geometry of the feature simplified for the
+// zoom level, always from the full geometry so a tile is the same whether it
+// is generated alone, queried or generated with all zoom levels of the cell
+func (s *s57Tiler) simplifiedGeometry(feature *cellFeature, zoom uint64) *tileGeometry {
+	if g, ok := feature.simplified[zoom]; ok {
+		return &g
+	}
+	g := simplifyGeometry(feature.projected, feature.geomType, s.layerSimplification(feature.layer), zoom, feature.edges)
+	feature.simplified[zoom] = g
+	return &g
+}
+
+func clampTile(v int64, zoom uint64) int64 {
+	max := int64(1)<<zoom - 1
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// coveredTiles returns the tiles of the zoom level whose buffered bounds
+// intersect the envelope
+func coveredTiles(envelope ogr.Envelope, zoom uint64) []m.TileID {
+	buffer := tileBuffer(zoom)
+	n := math.Min(envelope.MaxY()+buffer, MAX_LATITUDE)
+	s := math.Max(envelope.MinY()-buffer, -MAX_LATITUDE)
+	ul := m.Tile(envelope.MinX()-buffer, n, int(zoom))
+	lr := m.Tile(envelope.MaxX()+buffer, s, int(zoom))
+	tiles := make([]m.TileID, 0)
+	for x := clampTile(ul.X, zoom); x <= clampTile(lr.X, zoom); x++ {
+		for y := clampTile(ul.Y, zoom); y <= clampTile(lr.Y, zoom); y++ {
+			tiles = append(tiles, m.TileID{X: x, Y: y, Z: zoom})
+		}
+	}
+	return tiles
+}
+
+// GenerateTiles generates the tiles of a cell for all zoom levels in a single
+// pass. Every feature is assigned to the tiles it covers at each zoom level
+// and simplified once per zoom level. It stops at the first tile that can't
+// be written.
+func (s *s57Tiler) GenerateTiles(outPath string, file dataset.File, tiles map[string]m.TileID, progress func(done int, total int)) error {
+	c := s.getCell(file)
+
+	wanted := make(map[string]bool)
+	zoomSet := make(map[uint64]bool)
+	for _, tile := range tiles {
+		wanted[m.Tilestr(tile)] = true
+		zoomSet[tile.Z] = true
+	}
+	zooms := make([]uint64, 0, len(zoomSet))
+	for z := range zoomSet {
+		zooms = append(zooms, z)
+	}
+	sort.Slice(zooms, func(i, j int) bool { return zooms[i] > zooms[j] })
+
+	tileLayers := make(map[string]map[string][]*cellFeature)
+	for layerName, features := range c.layers {
+		layerBounds := file.Layers[layerName].Bounds
+		for _, feature := range features {
+			if len(feature.projected.parts) == 0 {
+				continue
+			}
+			for _, z := range zooms {
+				if !includeFeatureInTile(feature, m.TileID{Z: z}) {
+					continue
+				}
+				included := false
+				for _, tile := range coveredTiles(feature.envelope, z) {
+					key := m.Tilestr(tile)
+					if !wanted[key] || !layerBounds.Intersects(tileEnvelope(tile)) {
+						continue
+					}
+					if _, ok := tileLayers[key]; !ok {
+						tileLayers[key] = make(map[string][]*cellFeature)
+					}
+					tileLayers[key][layerName] = append(tileLayers[key][layerName], feature)
+					included = true
+				}
+				if included {
+					s.simplifiedGeometry(feature, z)
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(tiles))
+	for key := range wanted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for n, key := range keys {
+		if err := s.writeTile(outPath, file, m.Strtile(key), tileLayers[key]); err != nil {
+			return err
+		}
+		delete(tileLayers, key)
+		if progress != nil {
+			progress(n+1, len(keys))
+		}
+	}
+	return nil
+}
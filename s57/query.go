@@ -0,0 +1,93 @@
+package s57
+
+import (
+	"math"
+	"sort"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// pointInRing tests a point against a closed ring using the crossing number
+func pointInRing(p xy, ring []xy) bool {
+	inside := false
+	for i := 0; i < len(ring)-1; i++ {
+		a := ring[i]
+		b := ring[i+1]
+		if (a.y > p.y) != (b.y > p.y) && p.x < (b.x-a.x)*(p.y-a.y)/(b.y-a.y)+a.x {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// distance returns the distance in mercator meters from a point to the
+// projected geometry of a feature, 0 when the point is inside an area
+func (feature *cellFeature) distance(p xy) float64 {
+	distance := math.Inf(1)
+	if feature.geomType == ogr.GT_Polygon && len(feature.projected.parts) > 0 {
+		inside := pointInRing(p, feature.projected.parts[0])
+		for _, hole := range feature.projected.parts[1:] {
+			if pointInRing(p, hole) {
+				inside = false
+			}
+		}
+		if inside {
+			return 0
+		}
+	}
+	for _, part := range feature.projected.parts {
+		if len(part) == 1 {
+			distance = math.Min(distance, math.Hypot(p.x-part[0].x, p.y-part[0].y))
+		}
+		for i := 0; i < len(part)-1; i++ {
+			distance = math.Min(distance, segmentDistance(p, part[i], part[i+1]))
+		}
+	}
+	return distance
+}
+
+func sortedLayers(file dataset.File) []string {
+	layerNames := make([]string, 0, len(file.Layers))
+	for layerName := range file.Layers {
+		layerNames = append(layerNames, layerName)
+	}
+	sort.Strings(layerNames)
+	return layerNames
+}
+
+// Query returns all features within radius meters of a position that are
+// shown at the zoom level, from all cells covering the position
+func (s *s57Tiler) Query(lon float64, lat float64, radius float64, zoom int) GeoJSONFeatureCollection {
+	collection := NewFeatureCollection()
+	tile := m.Tile(lon, lat, zoom)
+
+	// meters on the ground are 1/cos(lat) mercator meters
+	scale := 1 / math.Cos(lat*math.Pi/180)
+	x, y := m.XY(lon, lat)
+	position := xy{x: x, y: y}
+	area := ogr.Envelope{}
+	area.SetMinX(lon - radius*scale/m.EARTH_RADIUS*180/math.Pi)
+	area.SetMaxX(lon + radius*scale/m.EARTH_RADIUS*180/math.Pi)
+	area.SetMinY(lat - radius/m.EARTH_RADIUS*180/math.Pi)
+	area.SetMaxY(lat + radius/m.EARTH_RADIUS*180/math.Pi)
+
+	for _, dataset := range s.datasets {
+		for _, file := range dataset.GetDatasetForTile(tile).Files {
+			c := s.getCell(file)
+			for _, layerName := range sortedLayers(file) {
+				for _, feature := range c.query(layerName, area) {
+					// the unsafe water and labels are not chart features
+					if feature.derived || !includeFeatureInTile(feature, tile) {
+						continue
+					}
+					if feature.distance(position) <= radius*scale {
+						collection.Features = append(collection.Features, toGeoJSONFeature(feature))
+					}
+				}
+			}
+		}
+	}
+	return collection
+}
@@ -0,0 +1,132 @@
+package reader
+
+// S-57 object and attribute catalogue (IHO S-57 Ed 3.1 Appendix A)
+
+type attributeDefinition struct {
+	Acronym string
+	Type    byte // A code string, E enumerated, L list, F float, I integer, S free text
+}
+
+var objectClasses = map[int]string{
+	1: "ADMARE", 2: "AIRARE", 3: "ACHBRT", 4: "ACHARE", 5: "BCNCAR", 6: "BCNISD", 7: "BCNLAT", 8: "BCNSAW", 9: "BCNSPP",
+	10: "BERTHS", 11: "BRIDGE", 12: "BUISGL", 13: "BUAARE", 14: "BOYCAR", 15: "BOYINB", 16: "BOYISD", 17: "BOYLAT",
+	18: "BOYSAW", 19: "BOYSPP", 20: "CBLARE", 21: "CBLOHD", 22: "CBLSUB", 23: "CANALS", 24: "CANBNK", 25: "CTSARE",
+	26: "CAUSWY", 27: "CTNARE", 28: "CHKPNT", 29: "CGUSTA", 30: "COALNE", 31: "CONZNE", 32: "COSARE", 33: "CTRPNT",
+	34: "CONVYR", 35: "CRANES", 36: "CURENT", 37: "CUSZNE", 38: "DAMCON", 39: "DAYMAR", 40: "DWRTCL", 41: "DWRTPT",
+	42: "DEPARE", 43: "DEPCNT", 44: "DISMAR", 45: "DOCARE", 46: "DRGARE", 47: "DRYDOC", 48: "DMPGRD", 49: "DYKCON",
+	50: "EXEZNE", 51: "FAIRWY", 52: "FNCLNE", 53: "FERYRT", 54: "FSHZNE", 55: "FSHFAC", 56: "FSHGRD", 57: "FLODOC",
+	58: "FOGSIG", 59: "FORSTC", 60: "FRPARE", 61: "GATCON", 62: "GRIDRN", 63: "HRBARE", 64: "HRBFAC", 65: "HULKES",
+	66: "ICEARE", 67: "ICNARE", 68: "ISTZNE", 69: "LAKARE", 70: "LAKSHR", 71: "LNDARE", 72: "LNDELV", 73: "LNDRGN",
+	74: "LNDMRK", 75: "LIGHTS", 76: "LITFLT", 77: "LITVES", 78: "LOCMAG", 79: "LOKBSN", 80: "LOGPON", 81: "MAGVAR",
+	82: "MARCUL", 83: "MIPARE", 84: "MORFAC", 85: "NAVLNE", 86: "OBSTRN", 87: "OFSPLF", 88: "OSPARE", 89: "OILBAR",
+	90: "PILPNT", 91: "PILBOP", 92: "PIPARE", 93: "PIPOHD", 94: "PIPSOL", 95: "PONTON", 96: "PRCARE", 97: "PRDARE",
+	98: "PYLONS", 99: "RADLNE", 100: "RADRNG", 101: "RADRFL", 102: "RADSTA", 103: "RTPBCN", 104: "RDOCAL",
+	105: "RDOSTA", 106: "RAILWY", 107: "RAPIDS", 108: "RCRTCL", 109: "RECTRC", 110: "RCTLPT", 111: "RSCSTA",
+	112: "RESARE", 113: "RETRFL", 114: "RIVERS", 115: "RIVBNK", 116: "ROADWY", 117: "RUNWAY", 118: "SNDWAV",
+	119: "SEAARE", 120: "SPLARE", 121: "SBDARE", 122: "SLCONS", 123: "SISTAT", 124: "SISTAW", 125: "SILTNK",
+	126: "SLOTOP", 127: "SLOGRD", 128: "SMCFAC", 129: "SOUNDG", 130: "SPRING", 131: "SQUARE", 132: "STSLNE",
+	133: "SUBTLN", 134: "SWPARE", 135: "TESARE", 136: "TS_PRH", 137: "TS_PNH", 138: "TS_PAD", 139: "TS_TIS",
+	140: "T_HMON", 141: "T_NHMN", 142: "T_TIMS", 143: "TIDEWY", 144: "TOPMAR", 145: "TSELNE", 146: "TSSBND",
+	147: "TSSCRS", 148: "TSSLPT", 149: "TSSRON", 150: "TSEZNE", 151: "TUNNEL", 152: "TWRTPT", 153: "UWTROC",
+	154: "UNSARE", 155: "VEGATN", 156: "WATTUR", 157: "WATFAL", 158: "WEDKLP", 159: "WRECKS", 160: "TS_FEB",
+	161: "ARCSLN", 162: "ASLXIS", 163: "NEWOBJ",
+	300: "M_ACCY", 301: "M_CSCL", 302: "M_COVR", 303: "M_HDAT", 304: "M_HOPA", 305: "M_NPUB", 306: "M_NSYS",
+	307: "M_PROD", 308: "M_QUAL", 309: "M_SDAT", 310: "M_SREL", 311: "M_UNIT", 312: "M_VDAT",
+	400: "C_AGGR", 401: "C_ASSO", 402: "C_STAC",
+	500: "$AREAS", 501: "$LINES", 502: "$CSYMB", 503: "$COMPS", 504: "$TEXTS",
+}
+
+// Inland ENC object classes (IENC Feature Catalogue), the IENC versions of
+// S-57 classes with extra attributes and the inland only classes, their
+// acronyms are in lower case like in the GDAL Inland_Waterways profile
+var inlandObjectClasses = map[int]string{
+	17000: "achbrt", 17001: "achare", 17002: "canbnk", 17003: "depare", 17004: "dismar", 17005: "resare",
+	17006: "rivbnk", 17007: "sistat", 17008: "sistaw", 17009: "topmar", 17010: "berths", 17011: "bridge",
+	17012: "cblohd", 17013: "feryrt", 17014: "hrbare", 17015: "hrbfac", 17016: "lokbsn", 17017: "rdocal",
+	17018: "m_nsys",
+	17050: "notmrk", 17051: "wtwaxs", 17052: "wtwprf", 17053: "brgare", 17054: "bunsta", 17055: "comare",
+	17056: "hrbbsn", 17057: "lokare", 17058: "lkbspt", 17059: "prtare", 17060: "bcnwtw", 17061: "boywtw",
+	17062: "refdmp", 17063: "rtplpt", 17064: "termnl", 17065: "trnbsn", 17066: "wtwgag", 17067: "tisdge",
+	17068: "vehtrf", 17069: "excnst",
+}
+
+// objectClass returns the acronym of an object class, inland cells also use
+// the Inland ENC classes
+func objectClass(objl int, inland bool) (string, bool) {
+	if name, ok := objectClasses[objl]; ok {
+		return name, true
+	}
+	if inland {
+		name, ok := inlandObjectClasses[objl]
+		return name, ok
+	}
+	return "", false
+}
+
+var attributes = map[int]attributeDefinition{
+	1: {"AGENCY", 'A'}, 2: {"BCNSHP", 'E'}, 3: {"BUISHP", 'E'}, 4: {"BOYSHP", 'E'}, 5: {"BURDEP", 'F'},
+	6: {"CALSGN", 'S'}, 7: {"CATAIR", 'L'}, 8: {"CATACH", 'L'}, 9: {"CATBRG", 'L'}, 10: {"CATBUA", 'E'},
+	11: {"CATCBL", 'E'}, 12: {"CATCAN", 'E'}, 13: {"CATCAM", 'E'}, 14: {"CATCHP", 'E'}, 15: {"CATCOA", 'E'},
+	16: {"CATCTR", 'E'}, 17: {"CATCON", 'E'}, 18: {"CATCOV", 'E'}, 19: {"CATCRN", 'E'}, 20: {"CATDAM", 'E'},
+	21: {"CATDIS", 'E'}, 22: {"CATDOC", 'E'}, 23: {"CATDPG", 'L'}, 24: {"CATFNC", 'E'}, 25: {"CATFRY", 'E'},
+	26: {"CATFIF", 'E'}, 27: {"CATFOG", 'E'}, 28: {"CATFOR", 'L'}, 29: {"CATGAT", 'E'}, 30: {"CATHAF", 'L'},
+	31: {"CATHLK", 'L'}, 32: {"CATICE", 'E'}, 33: {"CATINB", 'E'}, 34: {"CATLND", 'L'}, 35: {"CATLMK", 'L'},
+	36: {"CATLAM", 'E'}, 37: {"CATLIT", 'L'}, 38: {"CATMFA", 'E'}, 39: {"CATMPA", 'L'}, 40: {"CATMOR", 'E'},
+	41: {"CATNAV", 'E'}, 42: {"CATOBS", 'E'}, 43: {"CATOFP", 'L'}, 44: {"CATOLB", 'E'}, 45: {"CATPLE", 'E'},
+	46: {"CATPIL", 'E'}, 47: {"CATPIP", 'L'}, 48: {"CATPRA", 'E'}, 49: {"CATPYL", 'E'}, 50: {"CATQUA", 'E'},
+	51: {"CATRAS", 'E'}, 52: {"CATRTB", 'E'}, 53: {"CATROS", 'L'}, 54: {"CATTRK", 'E'}, 55: {"CATRSC", 'L'},
+	56: {"CATREA", 'L'}, 57: {"CATROD", 'E'}, 58: {"CATRUN", 'E'}, 59: {"CATSEA", 'E'}, 60: {"CATSIL", 'E'},
+	61: {"CATSLO", 'E'}, 62: {"CATSCF", 'L'}, 63: {"CATSLC", 'E'}, 64: {"CATSIT", 'L'}, 65: {"CATSIW", 'L'},
+	66: {"CATSPM", 'L'}, 67: {"CATTSS", 'E'}, 68: {"CATVEG", 'L'}, 69: {"CATWAT", 'E'}, 70: {"CATWED", 'E'},
+	71: {"CATWRK", 'E'}, 72: {"CATZOC", 'E'}, 73: {"$SPACE", 'E'}, 74: {"$CHARS", 'A'}, 75: {"COLOUR", 'L'},
+	76: {"COLPAT", 'L'}, 77: {"COMCHA", 'A'}, 78: {"$CSIZE", 'F'}, 79: {"CPDATE", 'A'}, 80: {"CSCALE", 'I'},
+	81: {"CONDTN", 'E'}, 82: {"CONRAD", 'E'}, 83: {"CONVIS", 'E'}, 84: {"CURVEL", 'F'}, 85: {"DATEND", 'A'},
+	86: {"DATSTA", 'A'}, 87: {"DRVAL1", 'F'}, 88: {"DRVAL2", 'F'}, 89: {"DUNITS", 'E'}, 90: {"ELEVAT", 'F'},
+	91: {"ESTRNG", 'F'}, 92: {"EXCLIT", 'E'}, 93: {"EXPSOU", 'E'}, 94: {"FUNCTN", 'L'}, 95: {"HEIGHT", 'F'},
+	96: {"HUNITS", 'E'}, 97: {"HORACC", 'F'}, 98: {"HORCLR", 'F'}, 99: {"HORLEN", 'F'}, 100: {"HORWID", 'F'},
+	101: {"ICEFAC", 'F'}, 102: {"INFORM", 'S'}, 103: {"JRSDTN", 'E'}, 104: {"$JUSTH", 'E'}, 105: {"$JUSTV", 'E'},
+	106: {"LIFCAP", 'F'}, 107: {"LITCHR", 'E'}, 108: {"LITVIS", 'L'}, 109: {"MARSYS", 'E'}, 110: {"MLTYLT", 'I'},
+	111: {"NATION", 'A'}, 112: {"NATCON", 'L'}, 113: {"NATSUR", 'L'}, 114: {"NATQUA", 'L'}, 115: {"NMDATE", 'A'},
+	116: {"OBJNAM", 'S'}, 117: {"ORIENT", 'F'}, 118: {"PEREND", 'A'}, 119: {"PERSTA", 'A'}, 120: {"PICREP", 'S'},
+	121: {"PILDST", 'S'}, 122: {"PRCTRY", 'A'}, 123: {"PRODCT", 'L'}, 124: {"PUBREF", 'S'}, 125: {"QUASOU", 'L'},
+	126: {"RADWAL", 'A'}, 127: {"RADIUS", 'F'}, 128: {"RECDAT", 'A'}, 129: {"RECIND", 'A'}, 130: {"RYRMGV", 'A'},
+	131: {"RESTRN", 'L'}, 132: {"SCAMAX", 'I'}, 133: {"SCAMIN", 'I'}, 134: {"SCVAL1", 'I'}, 135: {"SCVAL2", 'I'},
+	136: {"SECTR1", 'F'}, 137: {"SECTR2", 'F'}, 138: {"SHIPAM", 'A'}, 139: {"SIGFRQ", 'I'}, 140: {"SIGGEN", 'E'},
+	141: {"SIGGRP", 'A'}, 142: {"SIGPER", 'F'}, 143: {"SIGSEQ", 'A'}, 144: {"SOUACC", 'F'}, 145: {"SDISMX", 'I'},
+	146: {"SDISMN", 'I'}, 147: {"SORDAT", 'A'}, 148: {"SORIND", 'A'}, 149: {"STATUS", 'L'}, 150: {"SURATH", 'S'},
+	151: {"SUREND", 'A'}, 152: {"SURSTA", 'A'}, 153: {"SURTYP", 'L'}, 154: {"$SCALE", 'F'}, 155: {"$SCODE", 'A'},
+	156: {"TECSOU", 'L'}, 157: {"$TXSTR", 'S'}, 158: {"TXTDSC", 'S'}, 159: {"TS_TSP", 'A'}, 160: {"TS_TSV", 'A'},
+	161: {"T_ACWL", 'E'}, 162: {"T_HWLW", 'A'}, 163: {"T_MTOD", 'E'}, 164: {"T_THDF", 'A'}, 165: {"T_TINT", 'I'},
+	166: {"T_TSVL", 'A'}, 167: {"T_VAHC", 'A'}, 168: {"TIMEND", 'A'}, 169: {"TIMSTA", 'A'}, 170: {"$TINTS", 'E'},
+	171: {"TOPSHP", 'E'}, 172: {"TRAFIC", 'E'}, 173: {"VALACM", 'F'}, 174: {"VALDCO", 'F'}, 175: {"VALLMA", 'F'},
+	176: {"VALMAG", 'F'}, 177: {"VALMXR", 'F'}, 178: {"VALNMR", 'F'}, 179: {"VALSOU", 'F'}, 180: {"VERACC", 'F'},
+	181: {"VERCLR", 'F'}, 182: {"VERCCL", 'F'}, 183: {"VERCOP", 'F'}, 184: {"VERCSA", 'F'}, 185: {"VERDAT", 'E'},
+	186: {"VERLEN", 'F'}, 187: {"WATLEV", 'E'}, 188: {"CAT_TS", 'E'}, 189: {"PUNITS", 'E'}, 190: {"CLSDEF", 'S'},
+	191: {"CLSNAM", 'S'}, 192: {"SYMINS", 'S'},
+	300: {"NINFOM", 'S'}, 301: {"NOBJNM", 'S'}, 302: {"NPLDST", 'S'}, 303: {"$NTXST", 'S'}, 304: {"NTXTDS", 'S'},
+	400: {"HORDAT", 'E'}, 401: {"POSACC", 'F'}, 402: {"QUAPOS", 'E'},
+}
+
+// Inland ENC attributes, the IENC versions of S-57 attributes with extra
+// values and the inland only attributes
+var inlandAttributes = map[int]attributeDefinition{
+	17000: {"catach", 'L'}, 17001: {"catdis", 'E'}, 17002: {"catsit", 'L'}, 17003: {"catsiw", 'L'}, 17004: {"restrn", 'L'},
+	17005: {"verdat", 'E'}, 17006: {"catbrg", 'L'}, 17007: {"catfry", 'E'}, 17008: {"cathaf", 'L'}, 17009: {"marsys", 'E'},
+	17010: {"catchp", 'E'}, 17011: {"catlam", 'E'}, 17012: {"catslc", 'E'},
+	17050: {"addmrk", 'L'}, 17051: {"catbnk", 'E'}, 17052: {"catnmk", 'E'}, 17053: {"clsdng", 'E'}, 17054: {"dirimp", 'L'},
+	17055: {"disbk1", 'F'}, 17056: {"disbk2", 'F'}, 17057: {"fasbk1", 'F'}, 17058: {"fasbk2", 'F'}, 17059: {"hunits", 'E'},
+	17060: {"wtwdis", 'F'}, 17061: {"unlocd", 'A'},
+}
+
+// findAttribute returns the definition of an attribute, inland cells also use
+// the Inland ENC attributes
+func findAttribute(code int, inland bool) (attributeDefinition, bool) {
+	if definition, ok := attributes[code]; ok {
+		return definition, true
+	}
+	if inland {
+		definition, ok := inlandAttributes[code]
+		return definition, ok
+	}
+	return attributeDefinition{}, false
+}
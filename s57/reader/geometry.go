@@ -0,0 +1,259 @@
+package reader
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type GeometryType uint32
+
+// values match the OGR wkbGeometryType codes
+const (
+	GT_Unknown            GeometryType = 0
+	GT_Point              GeometryType = 1
+	GT_LineString         GeometryType = 2
+	GT_Polygon            GeometryType = 3
+	GT_MultiPoint         GeometryType = 4
+	GT_MultiLineString    GeometryType = 5
+	GT_MultiPolygon       GeometryType = 6
+	GT_GeometryCollection GeometryType = 7
+	GT_LinearRing         GeometryType = 101
+	GT_Point25D           GeometryType = 0x80000001
+	GT_MultiPoint25D      GeometryType = 0x80000004
+)
+
+type point struct {
+	x float64
+	y float64
+	z float64
+}
+
+// Geometry is a simple features geometry in lon/lat, points are held by
+// Point, LineString and LinearRing, the others are collections
+type Geometry struct {
+	geomType   GeometryType
+	points     []point
+	geometries []Geometry
+}
+
+type Envelope struct {
+	minX float64
+	maxX float64
+	minY float64
+	maxY float64
+}
+
+func (env Envelope) MinX() float64 { return env.minX }
+func (env Envelope) MaxX() float64 { return env.maxX }
+func (env Envelope) MinY() float64 { return env.minY }
+func (env Envelope) MaxY() float64 { return env.maxY }
+
+func (env *Envelope) SetMinX(val float64) { env.minX = val }
+func (env *Envelope) SetMaxX(val float64) { env.maxX = val }
+func (env *Envelope) SetMinY(val float64) { env.minY = val }
+func (env *Envelope) SetMaxY(val float64) { env.maxY = val }
+
+func (env Envelope) Intersects(other Envelope) bool {
+	return env.minX <= other.maxX && env.maxX >= other.minX && env.minY <= other.maxY && env.maxY >= other.minY
+}
+
+func (env Envelope) Contains(other Envelope) bool {
+	return env.minX <= other.minX && env.maxX >= other.maxX && env.minY <= other.minY && env.maxY >= other.maxY
+}
+
+func (env Envelope) Union(other Envelope) Envelope {
+	return Envelope{
+		minX: math.Min(env.minX, other.minX),
+		maxX: math.Max(env.maxX, other.maxX),
+		minY: math.Min(env.minY, other.minY),
+		maxY: math.Max(env.maxY, other.maxY),
+	}
+}
+
+func emptyEnvelope() Envelope {
+	return Envelope{minX: math.Inf(1), maxX: math.Inf(-1), minY: math.Inf(1), maxY: math.Inf(-1)}
+}
+
+func (env Envelope) isEmpty() bool {
+	return env.minX > env.maxX
+}
+
+func (geom Geometry) Destroy() {}
+
+// Clone returns the geometry itself, geometries are never modified in place
+func (geom Geometry) Clone() Geometry {
+	return geom
+}
+
+func (geom Geometry) Type() GeometryType {
+	return geom.geomType
+}
+
+func (geom Geometry) IsEmpty() bool {
+	return len(geom.points) == 0 && len(geom.geometries) == 0
+}
+
+func (geom Geometry) PointCount() int {
+	return len(geom.points)
+}
+
+func (geom Geometry) Point(index int) (x, y, z float64) {
+	p := geom.points[index]
+	return p.x, p.y, p.z
+}
+
+func (geom Geometry) GeometryCount() int {
+	return len(geom.geometries)
+}
+
+func (geom Geometry) Geometry(index int) Geometry {
+	return geom.geometries[index]
+}
+
+func (geom Geometry) Envelope() Envelope {
+	env := emptyEnvelope()
+	for _, p := range geom.points {
+		env.minX = math.Min(env.minX, p.x)
+		env.maxX = math.Max(env.maxX, p.x)
+		env.minY = math.Min(env.minY, p.y)
+		env.maxY = math.Max(env.maxY, p.y)
+	}
+	for _, g := range geom.geometries {
+		env = env.Union(g.Envelope())
+	}
+	return env
+}
+
+func perpendicularDistance(p point, a point, b point) float64 {
+	dx := b.x - a.x
+	dy := b.y - a.y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+	return math.Abs(dy*p.x-dx*p.y+b.x*a.y-b.y*a.x) / math.Hypot(dx, dy)
+}
+
+func douglasPeucker(points []point, tolerance float64, keep []bool, first int, last int) {
+	maxDistance := 0.0
+	index := -1
+	for i := first + 1; i < last; i++ {
+		d := perpendicularDistance(points[i], points[first], points[last])
+		if d > maxDistance {
+			maxDistance = d
+			index = i
+		}
+	}
+	if index >= 0 && maxDistance > tolerance {
+		keep[index] = true
+		douglasPeucker(points, tolerance, keep, first, index)
+		douglasPeucker(points, tolerance, keep, index, last)
+	}
+}
+
+func simplifyPoints(points []point, tolerance float64, minPoints int) []point {
+	if len(points) <= minPoints {
+		return points
+	}
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+	douglasPeucker(points, tolerance, keep, 0, len(points)-1)
+	result := make([]point, 0)
+	for i, p := range points {
+		if keep[i] {
+			result = append(result, p)
+		}
+	}
+	if len(result) < minPoints {
+		// too much removed for a valid geometry, keep the original
+		return points
+	}
+	return result
+}
+
+// SimplifyPreservingTopology simplifies using Douglas-Peucker, rings are kept
+// valid by never reducing them below four points
+func (geom Geometry) SimplifyPreservingTopology(tolerance float64) Geometry {
+	simplified := Geometry{geomType: geom.geomType}
+	switch geom.geomType {
+	case GT_LineString:
+		simplified.points = simplifyPoints(geom.points, tolerance, 2)
+	case GT_LinearRing:
+		simplified.points = simplifyPoints(geom.points, tolerance, 4)
+	default:
+		simplified.points = geom.points
+	}
+	for _, g := range geom.geometries {
+		simplified.geometries = append(simplified.geometries, g.SimplifyPreservingTopology(tolerance))
+	}
+	return simplified
+}
+
+// signed area of a closed ring, negative for clockwise rings
+func ringArea(points []point) float64 {
+	var sum float64 = 0
+	for i := 0; i < len(points)-1; i++ {
+		sum += points[i].x*points[i+1].y - points[i+1].x*points[i].y
+	}
+	return sum / 2
+}
+
+func (geom Geometry) is3D() bool {
+	return geom.geomType == GT_Point25D || geom.geomType == GT_MultiPoint25D
+}
+
+// wktPoints writes the points of a point, line string or ring
+func (geom Geometry) wktPoints(sb *strings.Builder, z bool) {
+	sb.WriteString("(")
+	for i, p := range geom.points {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(strconv.FormatFloat(p.x, 'f', -1, 64) + " " + strconv.FormatFloat(p.y, 'f', -1, 64))
+		if z {
+			sb.WriteString(" " + strconv.FormatFloat(p.z, 'f', -1, 64))
+		}
+	}
+	sb.WriteString(")")
+}
+
+func (geom Geometry) wktGeometries(sb *strings.Builder, z bool) {
+	sb.WriteString("(")
+	for i, g := range geom.geometries {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		if len(g.geometries) > 0 {
+			g.wktGeometries(sb, z)
+		} else {
+			g.wktPoints(sb, z)
+		}
+	}
+	sb.WriteString(")")
+}
+
+// ToWKT returns the geometry as well known text
+func (geom Geometry) ToWKT() (string, error) {
+	names := map[GeometryType]string{
+		GT_Point: "POINT", GT_Point25D: "POINT Z", GT_LineString: "LINESTRING", GT_LinearRing: "LINESTRING",
+		GT_Polygon: "POLYGON", GT_MultiPoint: "MULTIPOINT", GT_MultiPoint25D: "MULTIPOINT Z",
+		GT_MultiLineString: "MULTILINESTRING", GT_MultiPolygon: "MULTIPOLYGON",
+	}
+	name, ok := names[geom.geomType]
+	if !ok {
+		return "", fmt.Errorf("geometry type %d has no WKT", geom.geomType)
+	}
+	if geom.IsEmpty() {
+		return name + " EMPTY", nil
+	}
+	sb := &strings.Builder{}
+	sb.WriteString(name + " ")
+	if len(geom.geometries) > 0 {
+		geom.wktGeometries(sb, geom.is3D())
+	} else {
+		geom.wktPoints(sb, geom.is3D())
+	}
+	return sb.String(), nil
+}
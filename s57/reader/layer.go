@@ -0,0 +1,235 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type FieldType int
+
+// values match the OGRFieldType codes
+const (
+	FT_Integer       FieldType = 0
+	FT_IntegerList   FieldType = 1
+	FT_Real          FieldType = 2
+	FT_RealList      FieldType = 3
+	FT_String        FieldType = 4
+	FT_StringList    FieldType = 5
+	FT_Integer64     FieldType = 12
+	FT_Integer64List FieldType = 13
+)
+
+type FieldDefinition struct {
+	name      string
+	fieldType FieldType
+}
+
+func (fd FieldDefinition) Name() string    { return fd.name }
+func (fd FieldDefinition) Type() FieldType { return fd.fieldType }
+
+type fieldValue struct {
+	set    bool
+	value  string
+	values []string
+}
+
+// Feature is a S-57 feature object with its attributes decoded and the
+// geometry assembled from the vector records, it mimics an OGR feature
+type Feature struct {
+	layer    *layerDefinition
+	fid      int64
+	fields   []fieldValue
+	geometry Geometry
+}
+
+func (feature Feature) Destroy() {}
+
+func (feature Feature) FID() int64 {
+	return feature.fid
+}
+
+func (feature Feature) Geometry() Geometry {
+	return feature.geometry
+}
+
+func (feature Feature) FieldCount() int {
+	return len(feature.layer.fields)
+}
+
+func (feature Feature) FieldDefinition(index int) FieldDefinition {
+	return feature.layer.fields[index]
+}
+
+func (feature Feature) FieldIndex(name string) int {
+	return feature.layer.FieldIndex(name)
+}
+
+func (feature Feature) IsFieldSet(index int) bool {
+	return index >= 0 && index < len(feature.fields) && feature.fields[index].set
+}
+
+func (feature Feature) FieldAsString(index int) string {
+	if !feature.IsFieldSet(index) {
+		return ""
+	}
+	f := feature.fields[index]
+	if feature.layer.fields[index].fieldType == FT_StringList {
+		// same representation as OGR
+		return fmt.Sprintf("(%d:%s)", len(f.values), strings.Join(f.values, ","))
+	}
+	return f.value
+}
+
+func (feature Feature) FieldAsStringList(index int) []string {
+	if !feature.IsFieldSet(index) {
+		return nil
+	}
+	f := feature.fields[index]
+	if f.values != nil {
+		return f.values
+	}
+	return []string{f.value}
+}
+
+func (feature Feature) FieldAsInteger(index int) int {
+	return int(feature.FieldAsInteger64(index))
+}
+
+func (feature Feature) FieldAsInteger64(index int) int64 {
+	if !feature.IsFieldSet(index) {
+		return 0
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(feature.fields[index].value), 10, 64)
+	if err != nil {
+		return int64(feature.FieldAsFloat64(index))
+	}
+	return v
+}
+
+func (feature Feature) FieldAsFloat64(index int) float64 {
+	if !feature.IsFieldSet(index) {
+		return 0
+	}
+	v, _ := strconv.ParseFloat(strings.TrimSpace(feature.fields[index].value), 64)
+	return v
+}
+
+type layerDefinition struct {
+	name       string
+	fields     []FieldDefinition
+	fieldIndex map[string]int
+	features   []*Feature
+}
+
+type layerReading struct {
+	next   int
+	filter *Envelope
+}
+
+// Layer is a handle to the features of one object class, like an OGR layer
+// handle it keeps its own reading position and spatial filter
+type Layer struct {
+	*layerDefinition
+	reading *layerReading
+}
+
+func newLayerDefinition(name string) *layerDefinition {
+	return &layerDefinition{name: name, fieldIndex: make(map[string]int)}
+}
+
+func (layer *layerDefinition) addField(name string, fieldType FieldType) int {
+	if i, ok := layer.fieldIndex[name]; ok {
+		return i
+	}
+	layer.fieldIndex[name] = len(layer.fields)
+	layer.fields = append(layer.fields, FieldDefinition{name: name, fieldType: fieldType})
+	return len(layer.fields) - 1
+}
+
+func (layer *layerDefinition) FieldIndex(name string) int {
+	if i, ok := layer.fieldIndex[name]; ok {
+		return i
+	}
+	return -1
+}
+
+func (layer Layer) Name() string {
+	return layer.name
+}
+
+func (layer Layer) FeatureCount(force bool) (count int, ok bool) {
+	return len(layer.features), true
+}
+
+func (layer Layer) Extent(force bool) (env Envelope, err error) {
+	env = emptyEnvelope()
+	for _, f := range layer.features {
+		if !f.geometry.IsEmpty() {
+			env = env.Union(f.geometry.Envelope())
+		}
+	}
+	if env.isEmpty() {
+		return env, errors.New("layer has no geometry")
+	}
+	return env, nil
+}
+
+func (layer Layer) SetSpatialFilterRect(minX, minY, maxX, maxY float64) {
+	layer.reading.filter = &Envelope{minX: minX, minY: minY, maxX: maxX, maxY: maxY}
+	layer.reading.next = 0
+}
+
+func (layer Layer) ResetReading() {
+	layer.reading.next = 0
+}
+
+func (layer Layer) NextFeature() *Feature {
+	for layer.reading.next < len(layer.features) {
+		f := layer.features[layer.reading.next]
+		layer.reading.next++
+		filter := layer.reading.filter
+		if filter == nil || (!f.geometry.IsEmpty() && f.geometry.Envelope().Intersects(*filter)) {
+			return f
+		}
+	}
+	return nil
+}
+
+type DataSource struct {
+	layers []*layerDefinition
+}
+
+func (ds DataSource) Destroy() {}
+
+func (ds DataSource) LayerCount() int {
+	return len(ds.layers)
+}
+
+func (ds DataSource) LayerByIndex(index int) Layer {
+	return Layer{layerDefinition: ds.layers[index], reading: &layerReading{}}
+}
+
+func (ds DataSource) LayerByName(name string) Layer {
+	for _, l := range ds.layers {
+		if l.name == name {
+			return Layer{layerDefinition: l, reading: &layerReading{}}
+		}
+	}
+	return Layer{layerDefinition: newLayerDefinition(name), reading: &layerReading{}}
+}
+
+func sortLayers(layers map[string]*layerDefinition) []*layerDefinition {
+	names := make([]string, 0, len(layers))
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*layerDefinition, 0, len(names))
+	for _, name := range names {
+		result = append(result, layers[name])
+	}
+	return result
+}
@@ -0,0 +1,723 @@
+package reader
+
+// Pure Go S-57 reader, parses base cells and their updates directly from the
+// ISO 8211 records and assembles the vector topology into OGR like layers
+// see https://iho.int/uploads/user/pubs/standards/s-57/31Main.pdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/tburke/iso8211"
+	"github.com/wdantuma/s57-tiler/s57/vsi"
+)
+
+// record name codes
+const (
+	RCNM_DS = 10  // data set general information
+	RCNM_DP = 20  // data set geographic reference
+	RCNM_FE = 100 // feature
+	RCNM_VI = 110 // isolated node
+	RCNM_VC = 120 // connected node
+	RCNM_VE = 130 // edge
+	RCNM_VF = 140 // face
+)
+
+// record update instructions
+const (
+	RUIN_INSERT = 1
+	RUIN_DELETE = 2
+	RUIN_MODIFY = 3
+)
+
+// geometric primitives
+const (
+	PRIM_POINT = 1
+	PRIM_LINE  = 2
+	PRIM_AREA  = 3
+)
+
+const deleteValue = "\x7f"
+
+type recordKey struct {
+	rcnm int
+	rcid int
+}
+
+type vectorPointer struct {
+	key  recordKey
+	ornt int
+	usag int
+	topi int
+	mask int
+}
+
+type vectorRecord struct {
+	key      recordKey
+	rver     int
+	coords   []point
+	pointers []vectorPointer
+}
+
+type attribute struct {
+	code  int
+	value string
+}
+
+type featureRecord struct {
+	rcid int
+	prim int
+	grup int
+	objl int
+	rver int
+	agen int
+	fidn int
+	fids int
+	attf []attribute
+	natf []attribute
+	ffpt []string
+	fspt []vectorPointer
+}
+
+type cell struct {
+	path     string
+	comf     float64
+	somf     float64
+	aall     int
+	nall     int
+	dataset  map[string]interface{}
+	vectors  map[recordKey]*vectorRecord
+	features map[int]*featureRecord
+}
+
+func newCell(path string) *cell {
+	return &cell{
+		path:     path,
+		comf:     10000000,
+		somf:     10,
+		dataset:  make(map[string]interface{}),
+		vectors:  make(map[recordKey]*vectorRecord),
+		features: make(map[int]*featureRecord),
+	}
+}
+
+func toInt(v interface{}) int {
+	switch value := v.(type) {
+	case uint8:
+		return int(value)
+	case uint16:
+		return int(value)
+	case uint32:
+		return int(value)
+	case int8:
+		return int(value)
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case string:
+		i, _ := strconv.Atoi(strings.TrimSpace(value))
+		return i
+	}
+	return 0
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// groups returns the subfield values of a field per repetition, keyed by
+// subfield tag
+func groups(field iso8211.Field) []map[string]interface{} {
+	fieldType := field.FieldType
+	format := fieldType.Format()
+	result := make([]map[string]interface{}, 0)
+	if len(format) == 0 {
+		return result
+	}
+	for i := 0; i+len(format) <= len(field.SubFields); i += len(format) {
+		group := make(map[string]interface{}, len(format))
+		for j, sf := range format {
+			group[strings.TrimPrefix(string(sf.Tag), "*")] = field.SubFields[i+j]
+		}
+		result = append(result, group)
+	}
+	return result
+}
+
+func first(field iso8211.Field) map[string]interface{} {
+	g := groups(field)
+	if len(g) == 0 {
+		return make(map[string]interface{})
+	}
+	return g[0]
+}
+
+// decodeName decodes a B(40) NAME pointer, RCNM followed by RCID
+func decodeName(v interface{}) recordKey {
+	s := toString(v)
+	if len(s) < 5 {
+		return recordKey{}
+	}
+	return recordKey{rcnm: int(s[0]), rcid: int(binary.LittleEndian.Uint32([]byte(s[1:5])))}
+}
+
+func formatLNAM(agen int, fidn int, fids int) string {
+	return fmt.Sprintf("%04X%08X%04X", agen, fidn, fids)
+}
+
+// decodeLNAM decodes a B(64) long name, AGEN, FIDN and FIDS
+func decodeLNAM(v interface{}) string {
+	s := []byte(toString(v))
+	if len(s) < 8 {
+		return ""
+	}
+	return formatLNAM(int(binary.LittleEndian.Uint16(s[0:2])), int(binary.LittleEndian.Uint32(s[2:6])), int(binary.LittleEndian.Uint16(s[6:8])))
+}
+
+func latin1ToUTF8(s string) string {
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		runes = append(runes, rune(s[i]))
+	}
+	return string(runes)
+}
+
+// updateList applies an insert, delete or modify instruction at the one
+// based index of a pointer or coordinate list
+func updateList[T any](list []T, instruction int, index int, count int, values []T) []T {
+	index--
+	if index < 0 {
+		index = 0
+	}
+	if index > len(list) {
+		index = len(list)
+	}
+	switch instruction {
+	case RUIN_INSERT:
+		result := append([]T{}, list[:index]...)
+		result = append(result, values...)
+		return append(result, list[index:]...)
+	case RUIN_DELETE:
+		end := min(index+count, len(list))
+		return append(append([]T{}, list[:index]...), list[end:]...)
+	case RUIN_MODIFY:
+		result := append([]T{}, list...)
+		for i := 0; i < count && i < len(values) && index+i < len(result); i++ {
+			result[index+i] = values[i]
+		}
+		return result
+	}
+	return list
+}
+
+func (c *cell) readCoordinates(field iso8211.Field) []point {
+	coords := make([]point, 0)
+	for _, g := range groups(field) {
+		p := point{x: float64(toInt(g["XCOO"])) / c.comf, y: float64(toInt(g["YCOO"])) / c.comf}
+		if ve3d, ok := g["VE3D"]; ok {
+			p.z = float64(toInt(ve3d)) / c.somf
+		}
+		coords = append(coords, p)
+	}
+	return coords
+}
+
+func readVectorPointers(field iso8211.Field) []vectorPointer {
+	pointers := make([]vectorPointer, 0)
+	for _, g := range groups(field) {
+		pointers = append(pointers, vectorPointer{
+			key:  decodeName(g["NAME"]),
+			ornt: toInt(g["ORNT"]),
+			usag: toInt(g["USAG"]),
+			topi: toInt(g["TOPI"]),
+			mask: toInt(g["MASK"]),
+		})
+	}
+	return pointers
+}
+
+// readAttributes decodes the attribute values to UTF-8 using the lexical
+// level of the file being read, level 0 (ASCII) and 1 (ISO 8859-1) are both
+// read as ISO 8859-1 so stray 8 bit characters still give valid UTF-8
+func (c *cell) readAttributes(field iso8211.Field, lexicalLevel int) []attribute {
+	attributes := make([]attribute, 0)
+	for _, g := range groups(field) {
+		value := toString(g["ATVL"])
+		if lexicalLevel <= 1 {
+			value = latin1ToUTF8(value)
+		}
+		attributes = append(attributes, attribute{code: toInt(g["ATTL"]), value: value})
+	}
+	return attributes
+}
+
+// readUCS2Attributes decodes the raw data of a lexical level 2 NATF field,
+// the values are UCS-2 little endian terminated by a 16 bit unit terminator
+func readUCS2Attributes(data []byte) []attribute {
+	attributes := make([]attribute, 0)
+	// drop the field terminator, a UCS-2 1E 00 or a single 1E byte, it would
+	// otherwise be read as attribute code 30 (CATHAF)
+	if n := len(data); n >= 2 && data[n-2] == 0x1e && data[n-1] == 0 {
+		data = data[:n-2]
+	} else if n%2 == 1 && data[n-1] == 0x1e {
+		data = data[:n-1]
+	}
+	i := 0
+	for i+2 <= len(data) {
+		code := int(binary.LittleEndian.Uint16(data[i:]))
+		i += 2
+		units := make([]uint16, 0)
+		for i+2 <= len(data) {
+			unit := binary.LittleEndian.Uint16(data[i:])
+			i += 2
+			if unit == 0x1f || unit == 0x1e {
+				break
+			}
+			units = append(units, unit)
+		}
+		if code == 0 {
+			break
+		}
+		attributes = append(attributes, attribute{code: code, value: string(utf16.Decode(units))})
+	}
+	return attributes
+}
+
+func updateAttributes(current []attribute, updates []attribute) []attribute {
+	for _, u := range updates {
+		found := false
+		for i := range current {
+			if current[i].code == u.code {
+				current[i].value = u.value
+				found = true
+			}
+		}
+		if !found {
+			current = append(current, u)
+		}
+	}
+	result := make([]attribute, 0, len(current))
+	for _, a := range current {
+		if a.value != deleteValue {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (c *cell) readDataset(record iso8211.DataRecord) {
+	for _, field := range record.Fields {
+		switch field.Tag {
+		case "DSID", "DSSI", "DSPM":
+			for tag, value := range first(field) {
+				if tag != "RCNM" && tag != "RCID" {
+					c.dataset[field.Tag+"_"+tag] = value
+				}
+			}
+		}
+	}
+	if v, ok := c.dataset["DSPM_COMF"]; ok && toInt(v) > 0 {
+		c.comf = float64(toInt(v))
+	}
+	if v, ok := c.dataset["DSPM_SOMF"]; ok && toInt(v) > 0 {
+		c.somf = float64(toInt(v))
+	}
+	if v, ok := c.dataset["DSSI_AALL"]; ok {
+		c.aall = toInt(v)
+	}
+	if v, ok := c.dataset["DSSI_NALL"]; ok {
+		c.nall = toInt(v)
+	}
+}
+
+func (c *cell) readVector(record iso8211.DataRecord) {
+	var vector *vectorRecord
+	ruin := RUIN_INSERT
+	coordinateUpdate := []int{}
+	pointerUpdate := []int{}
+	for _, field := range record.Fields {
+		switch field.Tag {
+		case "VRID":
+			g := first(field)
+			key := recordKey{rcnm: toInt(g["RCNM"]), rcid: toInt(g["RCID"])}
+			ruin = toInt(g["RUIN"])
+			switch ruin {
+			case RUIN_DELETE:
+				delete(c.vectors, key)
+				return
+			case RUIN_MODIFY:
+				vector = c.vectors[key]
+				if vector == nil {
+					return
+				}
+			default:
+				vector = &vectorRecord{key: key}
+				c.vectors[key] = vector
+			}
+			vector.rver = toInt(g["RVER"])
+		case "VRPC":
+			g := first(field)
+			pointerUpdate = []int{toInt(g["VPUI"]), toInt(g["VPIX"]), toInt(g["NVPT"])}
+		case "VRPT":
+			pointers := readVectorPointers(field)
+			if len(pointerUpdate) == 3 {
+				vector.pointers = updateList(vector.pointers, pointerUpdate[0], pointerUpdate[1], pointerUpdate[2], pointers)
+			} else {
+				vector.pointers = pointers
+			}
+		case "SGCC":
+			g := first(field)
+			coordinateUpdate = []int{toInt(g["CCUI"]), toInt(g["CCIX"]), toInt(g["CCNC"])}
+		case "SG2D", "SG3D":
+			coords := c.readCoordinates(field)
+			if len(coordinateUpdate) == 3 {
+				vector.coords = updateList(vector.coords, coordinateUpdate[0], coordinateUpdate[1], coordinateUpdate[2], coords)
+			} else {
+				vector.coords = coords
+			}
+		}
+	}
+	// deletes come without a following coordinate or pointer field
+	if vector != nil && ruin == RUIN_MODIFY {
+		if len(coordinateUpdate) == 3 && coordinateUpdate[0] == RUIN_DELETE {
+			vector.coords = updateList(vector.coords, RUIN_DELETE, coordinateUpdate[1], coordinateUpdate[2], nil)
+		}
+		if len(pointerUpdate) == 3 && pointerUpdate[0] == RUIN_DELETE {
+			vector.pointers = updateList(vector.pointers, RUIN_DELETE, pointerUpdate[1], pointerUpdate[2], nil)
+		}
+	}
+}
+
+// readFeature reads a feature record, data holds the raw record for the
+// fields the ISO 8211 decoder can't split
+func (c *cell) readFeature(record iso8211.DataRecord, data []byte) {
+	var feature *featureRecord
+	ruin := RUIN_INSERT
+	spatialUpdate := []int{}
+	featureUpdate := []int{}
+	for _, field := range record.Fields {
+		switch field.Tag {
+		case "FRID":
+			g := first(field)
+			rcid := toInt(g["RCID"])
+			ruin = toInt(g["RUIN"])
+			switch ruin {
+			case RUIN_DELETE:
+				delete(c.features, rcid)
+				return
+			case RUIN_MODIFY:
+				feature = c.features[rcid]
+				if feature == nil {
+					return
+				}
+			default:
+				feature = &featureRecord{rcid: rcid, prim: toInt(g["PRIM"]), grup: toInt(g["GRUP"]), objl: toInt(g["OBJL"])}
+				c.features[rcid] = feature
+			}
+			feature.rver = toInt(g["RVER"])
+		case "FOID":
+			g := first(field)
+			feature.agen = toInt(g["AGEN"])
+			feature.fidn = toInt(g["FIDN"])
+			feature.fids = toInt(g["FIDS"])
+		case "ATTF":
+			feature.attf = updateAttributes(feature.attf, c.readAttributes(field, c.aall))
+		case "NATF":
+			if c.nall < 2 {
+				feature.natf = updateAttributes(feature.natf, c.readAttributes(field, c.nall))
+			} else {
+				// UCS-2 national attributes can't be split by the ISO 8211 decoder
+				start := int(record.Header.BaseAddress) + field.Position
+				if start+field.Length <= len(data) {
+					feature.natf = updateAttributes(feature.natf, readUCS2Attributes(data[start:start+field.Length]))
+				}
+			}
+		case "FFPC":
+			g := first(field)
+			featureUpdate = []int{toInt(g["FFUI"]), toInt(g["FFIX"]), toInt(g["NFPT"])}
+		case "FFPT":
+			refs := make([]string, 0)
+			for _, g := range groups(field) {
+				refs = append(refs, decodeLNAM(g["LNAM"]))
+			}
+			if len(featureUpdate) == 3 {
+				feature.ffpt = updateList(feature.ffpt, featureUpdate[0], featureUpdate[1], featureUpdate[2], refs)
+			} else {
+				feature.ffpt = refs
+			}
+		case "FSPC":
+			g := first(field)
+			spatialUpdate = []int{toInt(g["FSUI"]), toInt(g["FSIX"]), toInt(g["NSPT"])}
+		case "FSPT":
+			pointers := readVectorPointers(field)
+			if len(spatialUpdate) == 3 {
+				feature.fspt = updateList(feature.fspt, spatialUpdate[0], spatialUpdate[1], spatialUpdate[2], pointers)
+			} else {
+				feature.fspt = pointers
+			}
+		}
+	}
+	if feature != nil && ruin == RUIN_MODIFY {
+		if len(spatialUpdate) == 3 && spatialUpdate[0] == RUIN_DELETE {
+			feature.fspt = updateList(feature.fspt, RUIN_DELETE, spatialUpdate[1], spatialUpdate[2], nil)
+		}
+		if len(featureUpdate) == 3 && featureUpdate[0] == RUIN_DELETE {
+			feature.ffpt = updateList(feature.ffpt, RUIN_DELETE, featureUpdate[1], featureUpdate[2], nil)
+		}
+	}
+}
+
+// read reads a base cell or applies an update file
+func (c *cell) read(path string) (err error) {
+	defer func() {
+		// the iso8211 package panics on some files that are not ISO 8211
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", path, r)
+		}
+	}()
+	data, err := vsi.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
+	var l iso8211.LeadRecord
+	if err := l.Read(r); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for {
+		start := len(data) - r.Len()
+		d := iso8211.DataRecord{Lead: &l}
+		if d.Read(r) != nil {
+			break
+		}
+		if len(d.Fields) < 2 {
+			continue
+		}
+		switch d.Fields[1].Tag {
+		case "DSID", "DSPM":
+			c.readDataset(d)
+		case "VRID":
+			c.readVector(d)
+		case "FRID":
+			c.readFeature(d, data[start:])
+		}
+	}
+	return nil
+}
+
+// updateFiles returns the sequential update files (.001, .002, ...) next to
+// the base cell
+func updateFiles(path string) []string {
+	files := make([]string, 0)
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for n := 1; n < 1000; n++ {
+		updatePath := fmt.Sprintf("%s.%03d", base, n)
+		if !vsi.Exists(updatePath) {
+			break
+		}
+		files = append(files, updatePath)
+	}
+	return files
+}
+
+func attributeFieldType(attributeType byte) FieldType {
+	switch attributeType {
+	case 'E', 'I':
+		return FT_Integer
+	case 'F':
+		return FT_Real
+	case 'L':
+		return FT_StringList
+	}
+	return FT_String
+}
+
+// datasetLayer returns the DSID layer with one feature holding the data set
+// fields
+func datasetLayer(dataset map[string]interface{}) *layerDefinition {
+	layer := newLayerDefinition("DSID")
+	tags := make([]string, 0, len(dataset))
+	for tag := range dataset {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	feature := &Feature{layer: layer}
+	for _, tag := range tags {
+		value := dataset[tag]
+		fieldType := FT_Integer
+		if _, ok := value.(string); ok {
+			fieldType = FT_String
+		}
+		layer.addField(tag, fieldType)
+		feature.fields = append(feature.fields, fieldValue{set: true, value: strings.TrimSpace(toString(value))})
+	}
+	layer.features = append(layer.features, feature)
+	return layer
+}
+
+// inlandProduct returns true for the product specification (PSDN) of an
+// Inland ENC cell
+func inlandProduct(psdn string) bool {
+	psdn = strings.ToUpper(psdn)
+	return strings.Contains(psdn, "INLAND") || strings.Contains(psdn, "IENC")
+}
+
+// inland returns true for an Inland ENC cell, the product specification in
+// the DSID is an Inland ENC one
+func (c *cell) inland() bool {
+	return inlandProduct(toString(c.dataset["DSID_PSDN"]))
+}
+
+// readDSID returns the subfields of the DSID in the first data record of a
+// S-57 or S-101 file, only the DDR and that record are read. Encrypted S-63
+// cells have no DSID.
+func readDSID(path string) (dsid map[string]interface{}, ok bool) {
+	defer func() {
+		// the iso8211 package panics on some files that are not ISO 8211
+		if err := recover(); err != nil {
+			dsid, ok = nil, false
+		}
+	}()
+	f, err := vsi.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if leader, err := r.Peek(7); err != nil || leader[5] != '3' || leader[6] != 'L' {
+		return nil, false
+	}
+	var l iso8211.LeadRecord
+	if err := l.Read(r); err != nil {
+		return nil, false
+	}
+	d := iso8211.DataRecord{Lead: &l}
+	if err := d.Read(r); err != nil {
+		return nil, false
+	}
+	for _, field := range d.Fields {
+		if field.Tag == "DSID" {
+			return first(field), true
+		}
+	}
+	return nil, false
+}
+
+// IsInland returns true when a file is an Inland ENC cell, the product
+// specification in its DSID is an Inland ENC one
+func IsInland(path string) bool {
+	dsid, ok := readDSID(path)
+	return ok && inlandProduct(toString(dsid["PSDN"]))
+}
+
+func (c *cell) dataSource() DataSource {
+	layers := make(map[string]*layerDefinition)
+	rcids := make([]int, 0, len(c.features))
+	for rcid := range c.features {
+		rcids = append(rcids, rcid)
+	}
+	sort.Ints(rcids)
+
+	// fields are the fixed feature record fields followed by the attributes
+	// used by the features of the object class
+	layerAttributes := make(map[string]map[int]bool)
+	inland := c.inland()
+	for _, rcid := range rcids {
+		f := c.features[rcid]
+		name, ok := objectClass(f.objl, inland)
+		if !ok {
+			name = "Generic"
+		}
+		if _, ok := layers[name]; !ok {
+			layer := newLayerDefinition(name)
+			for _, field := range []string{"RCID", "PRIM", "GRUP", "OBJL", "RVER", "AGEN", "FIDN", "FIDS"} {
+				layer.addField(field, FT_Integer)
+			}
+			layer.addField("LNAM", FT_String)
+			layer.addField("LNAM_REFS", FT_StringList)
+			layers[name] = layer
+			layerAttributes[name] = make(map[int]bool)
+		}
+		for _, a := range append(append([]attribute{}, f.attf...), f.natf...) {
+			layerAttributes[name][a.code] = true
+		}
+	}
+	for name, codes := range layerAttributes {
+		sorted := make([]int, 0, len(codes))
+		for code := range codes {
+			if _, ok := findAttribute(code, inland); ok {
+				sorted = append(sorted, code)
+			}
+		}
+		sort.Ints(sorted)
+		for _, code := range sorted {
+			definition, _ := findAttribute(code, inland)
+			layers[name].addField(definition.Acronym, attributeFieldType(definition.Type))
+		}
+	}
+
+	for _, rcid := range rcids {
+		f := c.features[rcid]
+		name, ok := objectClass(f.objl, inland)
+		if !ok {
+			name = "Generic"
+		}
+		layer := layers[name]
+		feature := &Feature{layer: layer, fid: int64(f.rcid), fields: make([]fieldValue, len(layer.fields))}
+		for i, v := range []int{f.rcid, f.prim, f.grup, f.objl, f.rver, f.agen, f.fidn, f.fids} {
+			feature.fields[i] = fieldValue{set: true, value: strconv.Itoa(v)}
+		}
+		feature.fields[8] = fieldValue{set: true, value: formatLNAM(f.agen, f.fidn, f.fids)}
+		if len(f.ffpt) > 0 {
+			feature.fields[9] = fieldValue{set: true, values: f.ffpt}
+		}
+		for _, a := range append(append([]attribute{}, f.attf...), f.natf...) {
+			definition, ok := findAttribute(a.code, inland)
+			if !ok || a.value == "" {
+				continue
+			}
+			fv := fieldValue{set: true, value: a.value}
+			if definition.Type == 'L' {
+				fv.values = strings.Split(a.value, ",")
+			}
+			feature.fields[layer.FieldIndex(definition.Acronym)] = fv
+		}
+		feature.geometry = c.assembleGeometry(f)
+		layer.features = append(layer.features, feature)
+	}
+
+	ds := DataSource{layers: sortLayers(layers)}
+	if len(c.dataset) > 0 {
+		ds.layers = append([]*layerDefinition{datasetLayer(c.dataset)}, ds.layers...)
+	}
+	return ds
+}
+
+// Open reads a S-57 base cell and applies all its available update files,
+// S-101 cells are read with OpenS101
+func Open(path string) (DataSource, error) {
+	if IsS101(path) {
+		return OpenS101(path)
+	}
+	c := newCell(path)
+	if err := c.read(path); err != nil {
+		return DataSource{}, err
+	}
+	for _, update := range updateFiles(path) {
+		if err := c.read(update); err != nil {
+			return DataSource{}, err
+		}
+	}
+	return c.dataSource(), nil
+}
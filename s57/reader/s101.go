@@ -0,0 +1,677 @@
+package reader
+
+// Pure Go S-101 reader, S-101 cells are ISO 8211 files encoded following
+// S-100 Part 10a. Features reference points, multi points, curves, composite
+// curves and surfaces instead of the S-57 vector topology. The layers are
+// named after the S-57 object class of a feature type when there is one, see
+// s101catalogue.go, so the tiler handles them like S-57 layers.
+// see https://iho.int/en/s-100-based-product-specifications
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tburke/iso8211"
+	"github.com/wdantuma/s57-tiler/s57/vsi"
+)
+
+// S-101 record name codes
+const (
+	RCNM_S101_PT = 110 // point
+	RCNM_S101_MP = 115 // multi point
+	RCNM_S101_CU = 120 // curve
+	RCNM_S101_CC = 125 // composite curve
+	RCNM_S101_SU = 130 // surface
+)
+
+// usage of a ring of a surface
+const (
+	USAG_EXTERIOR = 1
+	USAG_INTERIOR = 2
+)
+
+// s101Ref is a reference to a spatial record, from a feature (SPAS), a curve
+// to its points (PTAS), a composite curve to its curves (CUCO) or a surface
+// to its rings (RIAS)
+type s101Ref struct {
+	key  recordKey
+	ornt int
+	usag int
+	topi int
+}
+
+type s101Attribute struct {
+	code  string
+	atix  int
+	paix  int
+	value string
+}
+
+type s101Spatial struct {
+	key    recordKey
+	rver   int
+	coords []point
+	is3D   bool
+	refs   []s101Ref
+}
+
+type s101Feature struct {
+	rcid       int
+	code       string
+	rver       int
+	agen       int
+	fidn       int
+	fids       int
+	attributes []s101Attribute
+	spas       []s101Ref
+}
+
+type s101Cell struct {
+	path           string
+	cmfx           float64
+	cmfy           float64
+	cmfz           float64
+	dataset        map[string]interface{}
+	featureCodes   map[int]string // feature type codes by their numeric code in the file
+	attributeCodes map[int]string // attribute codes by their numeric code in the file
+	spatials       map[recordKey]*s101Spatial
+	features       map[int]*s101Feature
+}
+
+func newS101Cell(path string) *s101Cell {
+	return &s101Cell{
+		path:           path,
+		cmfx:           10000000,
+		cmfy:           10000000,
+		cmfz:           100,
+		dataset:        make(map[string]interface{}),
+		featureCodes:   make(map[int]string),
+		attributeCodes: make(map[int]string),
+		spatials:       make(map[recordKey]*s101Spatial),
+		features:       make(map[int]*s101Feature),
+	}
+}
+
+// IsS101 returns true when a file is a S-101 cell, its DSID has the S-100
+// Part 10a encoding specification or a S-101 product specification
+func IsS101(path string) bool {
+	dsid, ok := readDSID(path)
+	return ok && (strings.Contains(toString(dsid["ENSP"]), "S-100") || strings.Contains(toString(dsid["PRSP"]), "S-101"))
+}
+
+func (c *s101Cell) readDataset(record iso8211.DataRecord, data []byte) {
+	for _, field := range record.Fields {
+		switch field.Tag {
+		case "DSID":
+			for tag, value := range first(field) {
+				if tag != "RCNM" && tag != "RCID" {
+					c.dataset[field.Tag+"_"+tag] = value
+				}
+			}
+		case "DSSI":
+			// the ISO 8211 decoder can't read the b48 floats of the DSSI,
+			// DCOX, DCOY and DCOZ are followed by CMFX, CMFY and CMFZ
+			start := int(record.Header.BaseAddress) + field.Position
+			if start+36 > len(data) {
+				continue
+			}
+			raw := data[start:]
+			for i, tag := range []string{"CMFX", "CMFY", "CMFZ"} {
+				cmf := binary.LittleEndian.Uint32(raw[24+4*i:])
+				c.dataset["DSSI_"+tag] = cmf
+				if cmf == 0 {
+					continue
+				}
+				switch tag {
+				case "CMFX":
+					c.cmfx = float64(cmf)
+				case "CMFY":
+					c.cmfy = float64(cmf)
+				case "CMFZ":
+					c.cmfz = float64(cmf)
+				}
+			}
+		case "FTCS":
+			for _, g := range groups(field) {
+				c.featureCodes[toInt(g["FTNC"])] = strings.TrimSpace(toString(g["FTCD"]))
+			}
+		case "ATCS":
+			for _, g := range groups(field) {
+				c.attributeCodes[toInt(g["ANCD"])] = strings.TrimSpace(toString(g["ATCD"]))
+			}
+		}
+	}
+}
+
+func (c *s101Cell) coordinate(y interface{}, x interface{}) point {
+	return point{x: float64(toInt(x)) / c.cmfx, y: float64(toInt(y)) / c.cmfy}
+}
+
+func (c *s101Cell) readCoordinates(field iso8211.Field) []point {
+	coords := make([]point, 0)
+	for _, g := range groups(field) {
+		p := c.coordinate(g["YCOO"], g["XCOO"])
+		if z, ok := g["ZCOO"]; ok {
+			p.z = float64(toInt(z)) / c.cmfz
+		}
+		coords = append(coords, p)
+	}
+	return coords
+}
+
+// read3DCoordinates reads the raw data of a C3IL field, the VCID followed by
+// repeating YCOO, XCOO and ZCOO, which the ISO 8211 decoder can't split
+func (c *s101Cell) read3DCoordinates(data []byte) []point {
+	coords := make([]point, 0)
+	for i := 1; i+12 <= len(data); i += 12 {
+		y := int32(binary.LittleEndian.Uint32(data[i:]))
+		x := int32(binary.LittleEndian.Uint32(data[i+4:]))
+		z := int32(binary.LittleEndian.Uint32(data[i+8:]))
+		p := c.coordinate(y, x)
+		p.z = float64(z) / c.cmfz
+		coords = append(coords, p)
+	}
+	return coords
+}
+
+func readS101Refs(field iso8211.Field) []s101Ref {
+	refs := make([]s101Ref, 0)
+	for _, g := range groups(field) {
+		refs = append(refs, s101Ref{
+			key:  recordKey{rcnm: toInt(g["RRNM"]), rcid: toInt(g["RRID"])},
+			ornt: toInt(g["ORNT"]),
+			usag: toInt(g["USAG"]),
+			topi: toInt(g["TOPI"]),
+		})
+	}
+	return refs
+}
+
+// readSpatial reads a point, multi point, curve, composite curve or surface
+// record, data holds the raw record for the fields the ISO 8211 decoder
+// can't split
+func (c *s101Cell) readSpatial(record iso8211.DataRecord, data []byte) {
+	var spatial *s101Spatial
+	ruin := RUIN_INSERT
+	coordinateUpdate := []int{}
+	refUpdate := []int{}
+	for _, field := range record.Fields {
+		switch field.Tag {
+		case "PRID", "MRID", "CRID", "CCID", "SRID":
+			g := first(field)
+			key := recordKey{rcnm: toInt(g["RCNM"]), rcid: toInt(g["RCID"])}
+			ruin = toInt(g["RUIN"])
+			switch ruin {
+			case RUIN_DELETE:
+				delete(c.spatials, key)
+				return
+			case RUIN_MODIFY:
+				spatial = c.spatials[key]
+				if spatial == nil {
+					return
+				}
+			default:
+				spatial = &s101Spatial{key: key}
+				c.spatials[key] = spatial
+			}
+			spatial.rver = toInt(g["RVER"])
+		case "COCC":
+			g := first(field)
+			coordinateUpdate = []int{toInt(g["COUI"]), toInt(g["COIX"]), toInt(g["NCOR"])}
+		case "C2IT", "C3IT", "C2IL", "C3IL":
+			var coords []point
+			if field.Tag == "C3IL" {
+				start := int(record.Header.BaseAddress) + field.Position
+				if start+field.Length > len(data) {
+					continue
+				}
+				coords = c.read3DCoordinates(data[start : start+field.Length])
+			} else {
+				coords = c.readCoordinates(field)
+			}
+			spatial.is3D = field.Tag == "C3IT" || field.Tag == "C3IL"
+			if len(coordinateUpdate) == 3 {
+				spatial.coords = updateList(spatial.coords, coordinateUpdate[0], coordinateUpdate[1], coordinateUpdate[2], coords)
+			} else {
+				spatial.coords = coords
+			}
+		case "CCOC":
+			g := first(field)
+			refUpdate = []int{toInt(g["CCUI"]), toInt(g["CCIX"]), toInt(g["NCCO"])}
+		case "PTAS", "CUCO", "RIAS":
+			refs := readS101Refs(field)
+			if len(refUpdate) == 3 {
+				spatial.refs = updateList(spatial.refs, refUpdate[0], refUpdate[1], refUpdate[2], refs)
+			} else {
+				spatial.refs = refs
+			}
+		}
+	}
+	// deletes come without a following coordinate or curve field
+	if spatial != nil && ruin == RUIN_MODIFY {
+		if len(coordinateUpdate) == 3 && coordinateUpdate[0] == RUIN_DELETE {
+			spatial.coords = updateList(spatial.coords, RUIN_DELETE, coordinateUpdate[1], coordinateUpdate[2], nil)
+		}
+		if len(refUpdate) == 3 && refUpdate[0] == RUIN_DELETE {
+			spatial.refs = updateList(spatial.refs, RUIN_DELETE, refUpdate[1], refUpdate[2], nil)
+		}
+	}
+}
+
+// updateS101Attributes applies the attribute instructions (ATIN) of an
+// update, attributes are matched by code, index and parent index
+func updateS101Attributes(current []s101Attribute, updates []s101Attribute, instructions []int) []s101Attribute {
+	for i, u := range updates {
+		found := -1
+		for j, a := range current {
+			if a.code == u.code && a.atix == u.atix && a.paix == u.paix {
+				found = j
+				break
+			}
+		}
+		switch {
+		case instructions[i] == RUIN_DELETE && found >= 0:
+			current = append(current[:found], current[found+1:]...)
+		case instructions[i] == RUIN_MODIFY && found >= 0:
+			current[found].value = u.value
+		case instructions[i] != RUIN_DELETE:
+			current = append(current, u)
+		}
+	}
+	return current
+}
+
+func (c *s101Cell) readFeature(record iso8211.DataRecord) {
+	var feature *s101Feature
+	ruin := RUIN_INSERT
+	spatialUpdate := []int{}
+	for _, field := range record.Fields {
+		switch field.Tag {
+		case "FRID":
+			g := first(field)
+			rcid := toInt(g["RCID"])
+			ruin = toInt(g["RUIN"])
+			switch ruin {
+			case RUIN_DELETE:
+				delete(c.features, rcid)
+				return
+			case RUIN_MODIFY:
+				feature = c.features[rcid]
+				if feature == nil {
+					return
+				}
+			default:
+				feature = &s101Feature{rcid: rcid, code: c.featureCodes[toInt(g["NFTC"])]}
+				c.features[rcid] = feature
+			}
+			feature.rver = toInt(g["RVER"])
+		case "FOID":
+			g := first(field)
+			feature.agen = toInt(g["AGEN"])
+			feature.fidn = toInt(g["FIDN"])
+			feature.fids = toInt(g["FIDS"])
+		case "ATTR":
+			attributes := make([]s101Attribute, 0)
+			instructions := make([]int, 0)
+			for _, g := range groups(field) {
+				attributes = append(attributes, s101Attribute{
+					code:  c.attributeCodes[toInt(g["NATC"])],
+					atix:  toInt(g["ATIX"]),
+					paix:  toInt(g["PAIX"]),
+					value: strings.TrimSpace(toString(g["ATVL"])),
+				})
+				instructions = append(instructions, toInt(g["ATIN"]))
+			}
+			if ruin == RUIN_MODIFY {
+				feature.attributes = updateS101Attributes(feature.attributes, attributes, instructions)
+			} else {
+				feature.attributes = attributes
+			}
+		case "SECC":
+			g := first(field)
+			spatialUpdate = []int{toInt(g["SEUI"]), toInt(g["SEIX"]), toInt(g["NSEG"])}
+		case "SPAS":
+			refs := readS101Refs(field)
+			if len(spatialUpdate) == 3 {
+				feature.spas = updateList(feature.spas, spatialUpdate[0], spatialUpdate[1], spatialUpdate[2], refs)
+			} else {
+				feature.spas = refs
+			}
+		}
+	}
+	if feature != nil && ruin == RUIN_MODIFY && len(spatialUpdate) == 3 && spatialUpdate[0] == RUIN_DELETE {
+		feature.spas = updateList(feature.spas, RUIN_DELETE, spatialUpdate[1], spatialUpdate[2], nil)
+	}
+}
+
+// read reads a base cell or applies an update file
+func (c *s101Cell) read(path string) (err error) {
+	defer func() {
+		// the iso8211 package panics on some files that are not ISO 8211
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", path, r)
+		}
+	}()
+	data, err := vsi.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
+	var l iso8211.LeadRecord
+	if err := l.Read(r); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for {
+		start := len(data) - r.Len()
+		d := iso8211.DataRecord{Lead: &l}
+		if d.Read(r) != nil {
+			break
+		}
+		if len(d.Fields) < 2 {
+			continue
+		}
+		switch d.Fields[1].Tag {
+		case "DSID":
+			c.readDataset(d, data[start:])
+		case "PRID", "MRID", "CRID", "CCID", "SRID":
+			c.readSpatial(d, data[start:])
+		case "FRID":
+			c.readFeature(d)
+		}
+	}
+	return nil
+}
+
+// curvePoints returns the points of a curve or composite curve in the
+// direction of the reference
+func (c *s101Cell) curvePoints(ref s101Ref) []point {
+	spatial, ok := c.spatials[ref.key]
+	if !ok {
+		return nil
+	}
+	points := make([]point, 0)
+	switch ref.key.rcnm {
+	case RCNM_S101_CU:
+		var begin, end *point
+		for _, pointRef := range spatial.refs {
+			p, ok := c.spatials[pointRef.key]
+			if !ok || len(p.coords) == 0 {
+				continue
+			}
+			if pointRef.topi != TOPI_END_NODE {
+				begin = &p.coords[0]
+			}
+			if pointRef.topi != TOPI_BEGINNING_NODE {
+				end = &p.coords[0]
+			}
+		}
+		// the segment may or may not repeat the bounding points
+		if begin != nil && (len(spatial.coords) == 0 || !samePoint(*begin, spatial.coords[0])) {
+			points = append(points, *begin)
+		}
+		points = append(points, spatial.coords...)
+		if end != nil && (len(points) == 0 || !samePoint(*end, points[len(points)-1])) {
+			points = append(points, *end)
+		}
+	case RCNM_S101_CC:
+		for _, curveRef := range spatial.refs {
+			curve := c.curvePoints(curveRef)
+			if len(curve) == 0 {
+				continue
+			}
+			if len(points) > 0 && samePoint(points[len(points)-1], curve[0]) {
+				curve = curve[1:]
+			}
+			points = append(points, curve...)
+		}
+	}
+	if ref.ornt == ORNT_REVERSE {
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	return points
+}
+
+// surface returns the polygon of a surface, the exterior ring first
+func (c *s101Cell) surface(key recordKey) (Geometry, bool) {
+	spatial, ok := c.spatials[key]
+	if !ok {
+		return Geometry{}, false
+	}
+	exterior := make([]Geometry, 0)
+	interior := make([]Geometry, 0)
+	for _, ringRef := range spatial.refs {
+		ring := c.curvePoints(ringRef)
+		if len(ring) < 3 {
+			continue
+		}
+		if !samePoint(ring[0], ring[len(ring)-1]) {
+			ring = append(ring, ring[0])
+		}
+		if ringRef.usag == USAG_INTERIOR {
+			interior = append(interior, Geometry{geomType: GT_LinearRing, points: ring})
+		} else {
+			exterior = append(exterior, Geometry{geomType: GT_LinearRing, points: ring})
+		}
+	}
+	if len(exterior) == 0 {
+		return Geometry{}, false
+	}
+	return Geometry{geomType: GT_Polygon, geometries: append(exterior[:1], interior...)}, true
+}
+
+// assembleGeometry returns the geometry of a feature from its spatial
+// associations, features without a spatial association have no geometry
+func (c *s101Cell) assembleGeometry(f *s101Feature) (Geometry, int) {
+	if len(f.spas) == 0 {
+		return Geometry{}, 255
+	}
+	switch f.spas[0].key.rcnm {
+	case RCNM_S101_PT:
+		points := make([]Geometry, 0)
+		for _, ref := range f.spas {
+			if spatial, ok := c.spatials[ref.key]; ok && len(spatial.coords) > 0 {
+				points = append(points, Geometry{geomType: GT_Point, points: spatial.coords[:1]})
+			}
+		}
+		switch len(points) {
+		case 0:
+			return Geometry{}, PRIM_POINT
+		case 1:
+			return points[0], PRIM_POINT
+		}
+		return Geometry{geomType: GT_MultiPoint, geometries: points}, PRIM_POINT
+	case RCNM_S101_MP:
+		spatial, ok := c.spatials[f.spas[0].key]
+		if !ok {
+			return Geometry{}, PRIM_POINT
+		}
+		multiPoint := Geometry{geomType: GT_MultiPoint}
+		pointType := GT_Point
+		if spatial.is3D {
+			multiPoint.geomType = GT_MultiPoint25D
+			pointType = GT_Point25D
+		}
+		for _, p := range spatial.coords {
+			multiPoint.geometries = append(multiPoint.geometries, Geometry{geomType: pointType, points: []point{p}})
+		}
+		return multiPoint, PRIM_POINT
+	case RCNM_S101_CU, RCNM_S101_CC:
+		lines := make([]Geometry, 0)
+		var current []point
+		for _, ref := range f.spas {
+			points := c.curvePoints(ref)
+			if len(points) == 0 {
+				continue
+			}
+			if len(current) > 0 && samePoint(current[len(current)-1], points[0]) {
+				current = append(current, points[1:]...)
+			} else {
+				if len(current) > 1 {
+					lines = append(lines, Geometry{geomType: GT_LineString, points: current})
+				}
+				current = append([]point{}, points...)
+			}
+		}
+		if len(current) > 1 {
+			lines = append(lines, Geometry{geomType: GT_LineString, points: current})
+		}
+		switch len(lines) {
+		case 0:
+			return Geometry{}, PRIM_LINE
+		case 1:
+			return lines[0], PRIM_LINE
+		}
+		return Geometry{geomType: GT_MultiLineString, geometries: lines}, PRIM_LINE
+	case RCNM_S101_SU:
+		polygons := make([]Geometry, 0)
+		for _, ref := range f.spas {
+			if polygon, ok := c.surface(ref.key); ok {
+				polygons = append(polygons, polygon)
+			}
+		}
+		switch len(polygons) {
+		case 0:
+			return Geometry{}, PRIM_AREA
+		case 1:
+			return polygons[0], PRIM_AREA
+		}
+		return Geometry{geomType: GT_MultiPolygon, geometries: polygons}, PRIM_AREA
+	}
+	return Geometry{}, 255
+}
+
+// s101Values returns the attribute values of a feature by field name, the
+// S-57 acronym or the S-101 code, in the order of the ATTR field. Complex
+// attributes are flattened, their sub attributes are read by their own code.
+func s101Values(f *s101Feature) (map[string][]string, []string) {
+	values := make(map[string][]string)
+	names := make([]string, 0)
+	for _, a := range f.attributes {
+		if a.value == "" || a.code == "" {
+			continue
+		}
+		name := a.code
+		if acronym, ok := s101Attributes[a.code]; ok {
+			name = acronym
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], a.value)
+	}
+	return values, names
+}
+
+// s101FieldType returns the field type of an attribute, the type of the S-57
+// attribute or a string (list) for S-101 only attributes
+func s101FieldType(name string, list bool) FieldType {
+	if definition, ok := attributesByAcronym[name]; ok {
+		return attributeFieldType(definition.Type)
+	}
+	if list {
+		return FT_StringList
+	}
+	return FT_String
+}
+
+func (c *s101Cell) dataSource() DataSource {
+	rcids := make([]int, 0, len(c.features))
+	for rcid := range c.features {
+		rcids = append(rcids, rcid)
+	}
+	sort.Ints(rcids)
+
+	layerName := func(f *s101Feature) string {
+		if acronym, ok := s101FeatureTypes[f.code]; ok {
+			return acronym
+		}
+		if f.code == "" {
+			return "Generic"
+		}
+		return f.code
+	}
+
+	// fields are the fixed feature fields followed by the attributes used by
+	// the features of the layer, repeated S-101 only attributes are lists
+	layers := make(map[string]*layerDefinition)
+	layerAttributes := make(map[string]map[string]bool)
+	for _, rcid := range rcids {
+		f := c.features[rcid]
+		name := layerName(f)
+		if _, ok := layers[name]; !ok {
+			layer := newLayerDefinition(name)
+			for _, field := range []string{"RCID", "PRIM", "OBJL", "RVER", "AGEN", "FIDN", "FIDS"} {
+				layer.addField(field, FT_Integer)
+			}
+			layer.addField("LNAM", FT_String)
+			layers[name] = layer
+			layerAttributes[name] = make(map[string]bool)
+		}
+		values, _ := s101Values(f)
+		for attribute, v := range values {
+			layerAttributes[name][attribute] = layerAttributes[name][attribute] || len(v) > 1
+		}
+	}
+	for name, attributes := range layerAttributes {
+		sorted := make([]string, 0, len(attributes))
+		for attribute := range attributes {
+			sorted = append(sorted, attribute)
+		}
+		sort.Strings(sorted)
+		for _, attribute := range sorted {
+			layers[name].addField(attribute, s101FieldType(attribute, attributes[attribute]))
+		}
+	}
+
+	for _, rcid := range rcids {
+		f := c.features[rcid]
+		layer := layers[layerName(f)]
+		geometry, prim := c.assembleGeometry(f)
+		feature := &Feature{layer: layer, fid: int64(f.rcid), fields: make([]fieldValue, len(layer.fields)), geometry: geometry}
+		for i, v := range []int{f.rcid, prim, objectClassCodes[layer.name], f.rver, f.agen, f.fidn, f.fids} {
+			feature.fields[i] = fieldValue{set: true, value: strconv.Itoa(v)}
+		}
+		// S-101 only feature types have no OBJL
+		feature.fields[2].set = objectClassCodes[layer.name] != 0
+		feature.fields[7] = fieldValue{set: true, value: formatLNAM(f.agen, f.fidn, f.fids)}
+		values, names := s101Values(f)
+		for _, name := range names {
+			index := layer.FieldIndex(name)
+			v := values[name]
+			switch layer.fields[index].fieldType {
+			case FT_StringList:
+				feature.fields[index] = fieldValue{set: true, value: strings.Join(v, ","), values: v}
+			default:
+				feature.fields[index] = fieldValue{set: true, value: v[0]}
+			}
+		}
+		layer.features = append(layer.features, feature)
+	}
+
+	ds := DataSource{layers: sortLayers(layers)}
+	if len(c.dataset) > 0 {
+		ds.layers = append([]*layerDefinition{datasetLayer(c.dataset)}, ds.layers...)
+	}
+	return ds
+}
+
+// OpenS101 reads a S-101 base cell and applies all its available update
+// files
+func OpenS101(path string) (DataSource, error) {
+	c := newS101Cell(path)
+	if err := c.read(path); err != nil {
+		return DataSource{}, err
+	}
+	for _, update := range updateFiles(path) {
+		if err := c.read(update); err != nil {
+			return DataSource{}, err
+		}
+	}
+	return c.dataSource(), nil
+}
@@ -0,0 +1,53 @@
+package reader
+
+// S-101 feature types and attributes with a S-57 equivalent (S-101 Feature
+// Catalogue), they are read as the S-57 object class or attribute so S-101
+// cells are styled and checked like S-57 cells. Feature types and attributes
+// without an equivalent keep their S-101 code.
+
+var s101FeatureTypes = map[string]string{
+	"AnchorageArea": "ACHARE", "BeaconCardinal": "BCNCAR", "BeaconIsolatedDanger": "BCNISD", "BeaconLateral": "BCNLAT",
+	"BeaconSafeWater": "BCNSAW", "BeaconSpecialPurposeGeneral": "BCNSPP", "Bridge": "BRIDGE", "Building": "BUISGL",
+	"BuiltUpArea": "BUAARE", "BuoyCardinal": "BOYCAR", "BuoyInstallation": "BOYINB", "BuoyIsolatedDanger": "BOYISD",
+	"BuoyLateral": "BOYLAT", "BuoySafeWater": "BOYSAW", "BuoySpecialPurposeGeneral": "BOYSPP", "CableOverhead": "CBLOHD",
+	"CableSubmarine": "CBLSUB", "Canal": "CANALS", "CautionArea": "CTNARE", "Causeway": "CAUSWY", "Checkpoint": "CHKPNT",
+	"Coastline": "COALNE", "Dam": "DAMCON", "DataCoverage": "M_COVR", "Daymark": "DAYMAR", "DepthArea": "DEPARE",
+	"DepthContour": "DEPCNT", "DredgedArea": "DRGARE", "Dyke": "DYKCON", "Fairway": "FAIRWY", "FogSignal": "FOGSIG",
+	"Gate": "GATCON", "HarbourAreaAdministrative": "HRBARE", "Lake": "LAKARE", "LandArea": "LNDARE", "LandRegion": "LNDRGN",
+	"Landmark": "LNDMRK", "LightAllAround": "LIGHTS", "LightSectored": "LIGHTS", "LockBasin": "LOKBSN",
+	"MilitaryPracticeArea": "MIPARE", "MooringWarpingFacility": "MORFAC", "NavigationLine": "NAVLNE", "Obstruction": "OBSTRN",
+	"Pile": "PILPNT", "PilotBoardingPlace": "PILBOP", "PipelineSubmarineOnLand": "PIPSOL", "Pontoon": "PONTON",
+	"QualityOfBathymetricData": "M_QUAL", "RadarReflector": "RADRFL", "Railway": "RAILWY", "RecommendedTrack": "RECTRC",
+	"RestrictedArea": "RESARE", "River": "RIVERS", "Road": "ROADWY", "SeaAreaNamedWaterArea": "SEAARE", "SeabedArea": "SBDARE",
+	"ShorelineConstruction": "SLCONS", "SlopeTopline": "SLOTOP", "Sounding": "SOUNDG", "Topmark": "TOPMAR",
+	"TrafficSeparationLine": "TSELNE", "TrafficSeparationSchemeBoundary": "TSSBND", "TrafficSeparationSchemeLanePart": "TSSLPT",
+	"Tunnel": "TUNNEL", "UnderwaterAwashRock": "UWTROC", "UnsurveyedArea": "UNSARE", "Vegetation": "VEGATN", "Wreck": "WRECKS",
+}
+
+var s101Attributes = map[string]string{
+	"beaconShape": "BCNSHP", "buoyShape": "BOYSHP", "categoryOfAnchorage": "CATACH", "categoryOfCardinalMark": "CATCAM",
+	"categoryOfCoastline": "CATCOA", "categoryOfLandmark": "CATLMK", "categoryOfLateralMark": "CATLAM",
+	"categoryOfObstruction": "CATOBS", "categoryOfRestrictedArea": "CATREA", "categoryOfWreck": "CATWRK", "colour": "COLOUR",
+	"colourPattern": "COLPAT", "depthRangeMaximumValue": "DRVAL2", "depthRangeMinimumValue": "DRVAL1", "elevation": "ELEVAT",
+	"height": "HEIGHT", "name": "OBJNAM", "natureOfSurface": "NATSUR", "pictorialRepresentation": "PICREP",
+	"qualityOfVerticalMeasurement": "QUASOU", "radarConspicuous": "CONRAD", "restriction": "RESTRN", "scaleMaximum": "SCAMAX",
+	"scaleMinimum": "SCAMIN", "signalGroup": "SIGGRP", "signalPeriod": "SIGPER", "status": "STATUS",
+	"techniqueOfVerticalMeasurement": "TECSOU", "topmarkDaymarkShape": "TOPSHP", "valueOfDepthContour": "VALDCO",
+	"valueOfNominalRange": "VALNMR", "valueOfSounding": "VALSOU", "verticalLength": "VERLEN", "visualProminence": "CONVIS",
+	"waterLevelEffect": "WATLEV",
+}
+
+// object class codes and attribute definitions by acronym
+var (
+	objectClassCodes    = make(map[string]int)
+	attributesByAcronym = make(map[string]attributeDefinition)
+)
+
+func init() {
+	for code, acronym := range objectClasses {
+		objectClassCodes[acronym] = code
+	}
+	for _, definition := range attributes {
+		attributesByAcronym[definition.Acronym] = definition
+	}
+}
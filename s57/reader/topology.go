@@ -0,0 +1,197 @@
+package reader
+
+import (
+	"math"
+)
+
+// topology indicators of the VRPT pointers of an edge
+const (
+	TOPI_BEGINNING_NODE = 1
+	TOPI_END_NODE       = 2
+)
+
+// orientation of an edge in a feature
+const (
+	ORNT_FORWARD = 1
+	ORNT_REVERSE = 2
+)
+
+func (c *cell) nodePoint(key recordKey) (point, bool) {
+	node, ok := c.vectors[key]
+	if !ok || len(node.coords) == 0 {
+		return point{}, false
+	}
+	return node.coords[0], true
+}
+
+// edgePoints returns the beginning node, the edge's own coordinates and the
+// end node of an edge
+func (c *cell) edgePoints(key recordKey) []point {
+	edge, ok := c.vectors[key]
+	if !ok {
+		return nil
+	}
+	var begin, end *point
+	for i, pointer := range edge.pointers {
+		topi := pointer.topi
+		if topi != TOPI_BEGINNING_NODE && topi != TOPI_END_NODE {
+			topi = i + 1
+		}
+		if p, ok := c.nodePoint(pointer.key); ok {
+			if topi == TOPI_BEGINNING_NODE {
+				begin = &p
+			} else {
+				end = &p
+			}
+		}
+	}
+	points := make([]point, 0, len(edge.coords)+2)
+	if begin != nil {
+		points = append(points, *begin)
+	}
+	points = append(points, edge.coords...)
+	if end != nil {
+		points = append(points, *end)
+	}
+	return points
+}
+
+func (c *cell) orientedEdge(pointer vectorPointer) []point {
+	points := c.edgePoints(pointer.key)
+	if pointer.ornt == ORNT_REVERSE {
+		reversed := make([]point, len(points))
+		for i, p := range points {
+			reversed[len(points)-1-i] = p
+		}
+		points = reversed
+	}
+	return points
+}
+
+func samePoint(a point, b point) bool {
+	return a.x == b.x && a.y == b.y
+}
+
+func (c *cell) assemblePoint(f *featureRecord) Geometry {
+	if len(f.fspt) == 0 {
+		return Geometry{}
+	}
+	node, ok := c.vectors[f.fspt[0].key]
+	if !ok || len(node.coords) == 0 {
+		return Geometry{}
+	}
+	if len(node.coords) == 1 {
+		return Geometry{geomType: GT_Point, points: node.coords}
+	}
+	// soundings, a node holding many 3D points
+	multiPoint := Geometry{geomType: GT_MultiPoint25D}
+	for _, p := range node.coords {
+		multiPoint.geometries = append(multiPoint.geometries, Geometry{geomType: GT_Point25D, points: []point{p}})
+	}
+	return multiPoint
+}
+
+func (c *cell) assembleLine(f *featureRecord) Geometry {
+	lines := make([]Geometry, 0)
+	var current []point
+	for _, pointer := range f.fspt {
+		points := c.orientedEdge(pointer)
+		if len(points) == 0 {
+			continue
+		}
+		if len(current) > 0 && samePoint(current[len(current)-1], points[0]) {
+			current = append(current, points[1:]...)
+		} else {
+			if len(current) > 1 {
+				lines = append(lines, Geometry{geomType: GT_LineString, points: current})
+			}
+			current = append([]point{}, points...)
+		}
+	}
+	if len(current) > 1 {
+		lines = append(lines, Geometry{geomType: GT_LineString, points: current})
+	}
+	switch len(lines) {
+	case 0:
+		return Geometry{}
+	case 1:
+		return lines[0]
+	}
+	return Geometry{geomType: GT_MultiLineString, geometries: lines}
+}
+
+// assembleArea links the edges of an area into closed rings, like OGR the ring
+// with the largest area becomes the exterior ring
+func (c *cell) assembleArea(f *featureRecord) Geometry {
+	edges := make([][]point, 0, len(f.fspt))
+	for _, pointer := range f.fspt {
+		if points := c.orientedEdge(pointer); len(points) > 1 {
+			edges = append(edges, points)
+		}
+	}
+	used := make([]bool, len(edges))
+	rings := make([][]point, 0)
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		ring := append([]point{}, edges[i]...)
+		for !samePoint(ring[0], ring[len(ring)-1]) {
+			found := false
+			for j := range edges {
+				if used[j] {
+					continue
+				}
+				last := ring[len(ring)-1]
+				if samePoint(edges[j][0], last) {
+					ring = append(ring, edges[j][1:]...)
+				} else if samePoint(edges[j][len(edges[j])-1], last) {
+					for k := len(edges[j]) - 2; k >= 0; k-- {
+						ring = append(ring, edges[j][k])
+					}
+				} else {
+					continue
+				}
+				used[j] = true
+				found = true
+				break
+			}
+			if !found {
+				ring = append(ring, ring[0])
+			}
+		}
+		if len(ring) >= 4 {
+			rings = append(rings, ring)
+		}
+	}
+	if len(rings) == 0 {
+		return Geometry{}
+	}
+	exterior := 0
+	for i, ring := range rings {
+		if math.Abs(ringArea(ring)) > math.Abs(ringArea(rings[exterior])) {
+			exterior = i
+		}
+	}
+	polygon := Geometry{geomType: GT_Polygon}
+	polygon.geometries = append(polygon.geometries, Geometry{geomType: GT_LinearRing, points: rings[exterior]})
+	for i, ring := range rings {
+		if i != exterior {
+			polygon.geometries = append(polygon.geometries, Geometry{geomType: GT_LinearRing, points: ring})
+		}
+	}
+	return polygon
+}
+
+func (c *cell) assembleGeometry(f *featureRecord) Geometry {
+	switch f.prim {
+	case PRIM_POINT:
+		return c.assemblePoint(f)
+	case PRIM_LINE:
+		return c.assembleLine(f)
+	case PRIM_AREA:
+		return c.assembleArea(f)
+	}
+	return Geometry{}
+}
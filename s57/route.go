@@ -0,0 +1,246 @@
+package s57
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// object classes checked along a route
+var hazardClasses = []string{"DEPARE", "DRGARE", "DEPCNT", "SOUNDG", "LNDARE", "UNSARE", "OBSTRN", "WRECKS", "UWTROC", "PILPNT", "RESARE", "CTNARE", "MIPARE"}
+
+type RoutePoint struct {
+	Lon float64
+	Lat float64
+}
+
+// Hazard is an object within the corridor of a route leg
+type Hazard struct {
+	Leg      int     `json:"leg"` // 0 is the leg from the first to the second route point
+	Layer    string  `json:"layer"`
+	Id       uint64  `json:"id"`
+	Name     string  `json:"name,omitempty"`
+	Reason   string  `json:"reason"`
+	Lon      float64 `json:"lon"` // position on the leg closest to the hazard
+	Lat      float64 `json:"lat"`
+	Distance float64 `json:"distance"` // meters along the leg
+	Offset   float64 `json:"offset"`   // meters from the leg, 0 when the leg crosses the hazard
+}
+
+// hazardReason tells why a feature is a hazard for the safety depth
+func hazardReason(feature *cellFeature, safetyDepth float64) (string, bool) {
+	switch feature.layer {
+	case "DEPARE", "DRGARE":
+		if drval1, ok := feature.depthValue("DRVAL1"); ok && drval1 < safetyDepth {
+			return fmt.Sprintf("depth %.1f m less than safety depth", drval1), true
+		}
+	case "DEPCNT":
+		if valdco, ok := feature.depthValue("VALDCO"); ok && valdco < safetyDepth {
+			return fmt.Sprintf("crosses %.1f m depth contour", valdco), true
+		}
+	case "OBSTRN", "WRECKS", "UWTROC":
+		valsou, ok := feature.depthValue("VALSOU")
+		if !ok {
+			return "danger of unknown depth", true
+		}
+		if valsou < safetyDepth {
+			return fmt.Sprintf("danger with %.1f m depth", valsou), true
+		}
+	case "LNDARE":
+		return "land", true
+	case "UNSARE":
+		return "unsurveyed area", true
+	case "PILPNT":
+		return "pile", true
+	case "RESARE":
+		return "restricted area", true
+	case "CTNARE":
+		return "caution area", true
+	case "MIPARE":
+		return "military practice area", true
+	}
+	return "", false
+}
+
+func cross(a xy, b xy) float64 {
+	return a.x*b.y - a.y*b.x
+}
+
+func sub(a xy, b xy) xy {
+	return xy{x: a.x - b.x, y: a.y - b.y}
+}
+
+// pointApproach returns the distance from p to leg ab and the fraction along
+// the leg of the closest point
+func pointApproach(p xy, a xy, b xy) (float64, float64) {
+	ab := sub(b, a)
+	t := 0.0
+	if ab.x != 0 || ab.y != 0 {
+		t = ((p.x-a.x)*ab.x + (p.y-a.y)*ab.y) / (ab.x*ab.x + ab.y*ab.y)
+		t = math.Max(0, math.Min(1, t))
+	}
+	return math.Hypot(p.x-(a.x+t*ab.x), p.y-(a.y+t*ab.y)), t
+}
+
+// segmentApproach returns the distance between segment pq and leg ab and the
+// fraction along the leg where they are closest
+func segmentApproach(p xy, q xy, a xy, b xy) (float64, float64) {
+	ab := sub(b, a)
+	pq := sub(q, p)
+	if d := cross(ab, pq); d != 0 {
+		t := cross(sub(p, a), pq) / d
+		u := cross(sub(p, a), ab) / d
+		if t >= 0 && t <= 1 && u >= 0 && u <= 1 {
+			return 0, t
+		}
+	}
+	distance, along := pointApproach(p, a, b)
+	if d, t := pointApproach(q, a, b); d < distance {
+		distance, along = d, t
+	}
+	if d := segmentDistance(a, p, q); d < distance {
+		distance, along = d, 0
+	}
+	if d := segmentDistance(b, p, q); d < distance {
+		distance, along = d, 1
+	}
+	return distance, along
+}
+
+// approach returns the distance in mercator meters between the feature and
+// leg ab, and the fraction along the leg where the leg first gets closest
+func (feature *cellFeature) approach(a xy, b xy) (float64, float64) {
+	distance, along := math.Inf(1), 0.0
+	update := func(d float64, t float64) {
+		if d < distance || d == distance && t < along {
+			distance, along = d, t
+		}
+	}
+	if feature.geomType == ogr.GT_Polygon && feature.distance(a) == 0 {
+		update(0, 0)
+	}
+	for _, part := range feature.projected.parts {
+		if len(part) == 1 {
+			update(pointApproach(part[0], a, b))
+		}
+		for i := 0; i < len(part)-1; i++ {
+			update(segmentApproach(part[i], part[i+1], a, b))
+		}
+	}
+	return distance, along
+}
+
+func legArea(from RoutePoint, to RoutePoint, corridorWidth float64) ogr.Envelope {
+	lat := math.Max(math.Abs(from.Lat), math.Abs(to.Lat))
+	dLat := corridorWidth / m.EARTH_RADIUS * 180 / math.Pi
+	dLon := dLat / math.Cos(math.Min(lat, MAX_LATITUDE)*math.Pi/180)
+	area := ogr.Envelope{}
+	area.SetMinX(math.Min(from.Lon, to.Lon) - dLon)
+	area.SetMaxX(math.Max(from.Lon, to.Lon) + dLon)
+	area.SetMinY(math.Min(from.Lat, to.Lat) - dLat)
+	area.SetMaxY(math.Max(from.Lat, to.Lat) + dLat)
+	return area
+}
+
+func fileIntersects(file dataset.File, area ogr.Envelope) bool {
+	for _, layer := range file.Layers {
+		if layer.Bounds.Intersects(area) {
+			return true
+		}
+	}
+	return false
+}
+
+// a feature is reported once per leg and a sounding once per sounding, keyed
+// by the feature itself as the id is 0 without LNAM and hashed ids can collide
+type hazardKey struct {
+	leg     int
+	feature *cellFeature
+	part    int
+}
+
+// CheckRoute returns the hazards within the corridor of every leg of the
+// route, the corridor is corridorWidth meters wide centered on the leg.
+// Hazards are ordered by leg and distance along the leg.
+func (s *s57Tiler) CheckRoute(route []RoutePoint, safetyDepth float64, corridorWidth float64) []Hazard {
+	hazards := make([]Hazard, 0)
+	found := make(map[hazardKey]bool)
+	for leg := 0; leg < len(route)-1; leg++ {
+		from := route[leg]
+		to := route[leg+1]
+		ax, ay := m.XY(from.Lon, from.Lat)
+		bx, by := m.XY(to.Lon, to.Lat)
+		a := xy{x: ax, y: ay}
+		b := xy{x: bx, y: by}
+		// mercator meters to meters on the ground
+		scale := math.Cos((from.Lat + to.Lat) / 2 * math.Pi / 180)
+		legLength := math.Hypot(b.x-a.x, b.y-a.y) * scale
+		area := legArea(from, to, corridorWidth)
+
+		addHazard := func(feature *cellFeature, part int, reason string, distance float64, along float64) {
+			key := hazardKey{leg: leg, feature: feature, part: part}
+			if found[key] {
+				return
+			}
+			found[key] = true
+			lon, lat := m.LngLat(a.x+along*(b.x-a.x), a.y+along*(b.y-a.y))
+			hazards = append(hazards, Hazard{Leg: leg, Layer: feature.layer, Id: feature.id, Name: feature.stringValue("OBJNAM"), Reason: reason,
+				Lon: lon, Lat: lat, Distance: along * legLength, Offset: distance * scale})
+		}
+
+		for _, dataset := range s.datasets {
+			for _, file := range dataset.Files {
+				if !fileIntersects(file, area) {
+					continue
+				}
+				c := s.getCell(file)
+				for _, layerName := range hazardClasses {
+					if !file.LayerExists(layerName) {
+						continue
+					}
+					for _, feature := range c.query(layerName, area) {
+						if layerName == "SOUNDG" {
+							// every sounding of the feature is checked on its own depth
+							for i, part := range feature.projected.parts {
+								var depth float64
+								if i < feature.geometry.GeometryCount() {
+									sounding := feature.geometry.Geometry(i)
+									_, _, depth = sounding.Point(0)
+								} else {
+									_, _, depth = feature.geometry.Point(0)
+								}
+								if feature.units != nil {
+									depth = depthToMetres(depth, feature.units.duni)
+								}
+								distance, along := pointApproach(part[0], a, b)
+								if depth < safetyDepth && distance*scale <= corridorWidth/2 {
+									addHazard(feature, i, fmt.Sprintf("sounding %.1f m", depth), distance, along)
+								}
+							}
+							continue
+						}
+						reason, ok := hazardReason(feature, safetyDepth)
+						if !ok {
+							continue
+						}
+						distance, along := feature.approach(a, b)
+						if distance*scale <= corridorWidth/2 {
+							addHazard(feature, 0, reason, distance, along)
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(hazards, func(i, j int) bool {
+		if hazards[i].Leg != hazards[j].Leg {
+			return hazards[i].Leg < hazards[j].Leg
+		}
+		return hazards[i].Distance < hazards[j].Distance
+	})
+	return hazards
+}
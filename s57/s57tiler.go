@@ -6,17 +6,14 @@ package s57
 import (
 	"encoding/json"
 	"fmt"
-	"log"
-	"math"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/lukeroth/gdal"
 	"github.com/wdantuma/s57-tiler/s57/dataset"
 	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
 	"github.com/wdantuma/s57-tiler/s57/vectortile"
 	"github.com/wdantuma/signalk-server-go/ref"
 	"github.com/wdantuma/signalk-server-go/resources/charts"
@@ -25,8 +22,7 @@ import (
 
 const (
 	TILE_EXTENT                   = 4096
-	TILE_DIMENSION_AT_0   float64 = 360 //40075016.686
-	SIMPLIFICATION_FACTOR         = 1
+	SIMPLIFICATION_FACTOR float64 = 1 // default tolerance in pixels
 )
 
 type ValueType int
@@ -42,26 +38,37 @@ type Value struct {
 	value     interface{}
 }
 
-type s57Tiler struct {
-	minZoom   int
-	maxZoom   int
-	transform gdal.CoordinateTransform
-	datasets  []dataset.Dataset
-	valuesMap map[string]uint32
-	values    []Value
-	keysMap   map[string]uint32
-	keys      []string
-	lastx     int32
-	lasty     int32
+type Options struct {
+	Validate       bool                      // validate every tile against the MVT spec
+	Repair         bool                      // repair violations found during validation
+	Simplification map[string]Simplification // simplification per layer, DefaultSimplification when nil
+	OmitLNAM       bool                      // leave out the LNAM attribute, the feature id is derived from it
+	MaxCells       int                       // cells kept loaded, the least recently used cell is released when more are loaded, no limit when 0
+	SafetyDepth    float64                   // add a layer with the unsafe water for this depth when set
+	DangerRadius   float64                   // radius in meters of the unsafe water around a point danger
+	Labels         bool                      // add a layer with a label point per named area and line
+	LabelLanguage  string                    // LABEL_NATIONAL or LABEL_INTERNATIONAL, adds a name attribute when set
+	Attachments    bool                      // link TXTDSC, NTXTDS and PICREP to the files copied by GenerateAttachments
+	DepthUnits     string                    // DEPTH_METRES, DEPTH_FEET or DEPTH_FATHOMS, depths and heights are converted when set
 }
 
-func NewS57Tiler(datasets []dataset.Dataset, minzoom int, maxzoom int) *s57Tiler {
-	src := gdal.CreateSpatialReference("")
-	src.FromEPSG(4326)
-	dst := gdal.CreateSpatialReference("")
-	dst.FromEPSG(3857)
+type s57Tiler struct {
+	minZoom     int
+	maxZoom     int
+	options     Options
+	cells       map[string]*cell
+	cellOrder   []string // paths of the loaded cells, least recently used first
+	violations  map[string][]Violation
+	datasets    []dataset.Dataset
+	valuesMap   map[string]uint32
+	values      []Value
+	keysMap     map[string]uint32
+	keys        []string
+	searchIndex []SearchEntry
+}
 
-	return &s57Tiler{transform: gdal.CreateCoordinateTransform(src, dst), datasets: datasets, minZoom: minzoom, maxZoom: maxzoom}
+func NewS57Tiler(datasets []dataset.Dataset, minzoom int, maxzoom int, options Options) *s57Tiler {
+	return &s57Tiler{cells: make(map[string]*cell), datasets: datasets, minZoom: minzoom, maxZoom: maxzoom, options: options, violations: make(map[string][]Violation)}
 }
 
 func (s *s57Tiler) startLayer() {
@@ -71,30 +78,25 @@ func (s *s57Tiler) startLayer() {
 	s.keys = make([]string, 0)
 }
 
-func (s *s57Tiler) to3857(x float64, y float64) (float64, float64) {
-	xs := make([]float64, 1)
-	xs[0] = y
-	ys := make([]float64, 1)
-	ys[0] = x
-	zs := make([]float64, 1)
-	zs[0] = 0
-
-	s.transform.Transform(1, xs, ys, zs)
-
-	return xs[0], ys[0]
+// tileTransform converts spherical mercator meters to the coordinates of one
+// tile, the tile corners are projected once per tile
+type tileTransform struct {
+	ulx float64
+	uly float64
+	xf  float64
+	yf  float64
 }
 
-func (s *s57Tiler) toTileCoordinate(tileBounds m.Extrema, x float64, y float64, z float64) (int32, int32, int32) {
-	tx, ty := s.to3857(x, y)
-
-	ulx, uly := s.to3857(tileBounds.W, tileBounds.N)
-	lrx, lry := s.to3857(tileBounds.E, tileBounds.S)
+func newTileTransform(tileBounds m.Extrema) tileTransform {
+	ulx, uly := m.XY(tileBounds.W, tileBounds.N)
+	lrx, lry := m.XY(tileBounds.E, tileBounds.S)
+	return tileTransform{ulx: ulx, uly: uly, xf: TILE_EXTENT / (lrx - ulx), yf: TILE_EXTENT / (uly - lry)}
+}
 
-	xf := TILE_EXTENT / (lrx - ulx)
-	yf := TILE_EXTENT / (uly - lry)
-	xx := (tx - ulx) * xf
-	yy := (uly - ty) * yf
-	return int32(xx), int32(yy), 0
+func (t tileTransform) toTileCoordinate(p xy) (int32, int32) {
+	xx := (p.x - t.ulx) * t.xf
+	yy := (t.uly - p.y) * t.yf
+	return int32(xx), int32(yy)
 }
 
 func getCommand(command int, count int) uint32 {
@@ -106,133 +108,57 @@ func getCoordinate(coordinate int32) uint32 {
 	return uint32((coordinate << 1) ^ (coordinate >> 31))
 }
 
-func IsClockWise(geom *gdal.Geometry) bool {
-	pc := geom.PointCount()
-	if pc < 2 {
-		return false
-	}
-	var sum float64 = 0
-	for i := 0; i < pc-1; i++ {
-		x1, y1, _ := geom.Point(i)
-		x2, y2, _ := geom.Point(i + 1)
-		sum += (x2 - x1) * (y2 + y1)
-	}
-	return sum > 0
-}
-
-func (s *s57Tiler) toMvtLinestringGeometry(geometry *gdal.Geometry, tileBounds m.Extrema, ccw bool) []uint32 {
-	mvtGeometry := make([]uint32, 0)
-	count := geometry.PointCount()
-
-	if count > 1 {
-		index := 0
-		step := 1
-		clockWise := IsClockWise(geometry)
-		if ccw && clockWise || !ccw && !clockWise {
-			index = count - 1
-			step = -1
-		}
-		// moveto
-		mvtGeometry = append(mvtGeometry, getCommand(1, 1))
-		x, y, _ := geometry.Point(index)
-		xx, yy, _ := s.toTileCoordinate(tileBounds, x, y, 0)
-		dx := xx - s.lastx
-		dy := yy - s.lasty
-		s.lastx = xx
-		s.lasty = yy
-		mvtGeometry = append(mvtGeometry, getCoordinate(dx))
-		mvtGeometry = append(mvtGeometry, getCoordinate(dy))
-		// lineto
-		mvtGeometry = append(mvtGeometry, getCommand(2, count-1))
-		for i := 1; i < count; i++ {
-			index += step
-			x, y, _ := geometry.Point(index)
-			xx, yy, _ := s.toTileCoordinate(tileBounds, x, y, 0)
-			dx := xx - s.lastx
-			dy := yy - s.lasty
-			mvtGeometry = append(mvtGeometry, getCoordinate(dx))
-			mvtGeometry = append(mvtGeometry, getCoordinate(dy))
-			s.lastx = xx
-			s.lasty = yy
-		}
-	}
-
-	return mvtGeometry
-}
-
-func (s *s57Tiler) toMvtPolygonGeometry(geometry *gdal.Geometry, tileBounds m.Extrema, ccw bool) []uint32 {
-	mvtGeometry := s.toMvtLinestringGeometry(geometry, tileBounds, ccw)
-	// close path
-	mvtGeometry = append(mvtGeometry, getCommand(7, 1))
-	return mvtGeometry
-}
-
-func (s *s57Tiler) toMvtPointGeometry(geometry *gdal.Geometry, tileBounds m.Extrema) []uint32 {
-	mvtGeometry := make([]uint32, 0)
-	count := geometry.PointCount()
-	mvtGeometry = append(mvtGeometry, getCommand(1, count))
-	for i := 0; i < count; i++ {
-		x, y, _ := geometry.Point(i)
-		xx, yy, _ := s.toTileCoordinate(tileBounds, x, y, 0)
-		dx := xx - s.lastx
-		dy := yy - s.lasty
-		mvtGeometry = append(mvtGeometry, getCoordinate(dx))
-		mvtGeometry = append(mvtGeometry, getCoordinate(dy))
-		s.lastx = xx
-		s.lasty = yy
-	}
-
-	return mvtGeometry
-}
-
-func (s *s57Tiler) toMvtGeometry(featureType vectortile.Tile_GeomType, geometry *gdal.Geometry, tile m.TileID, tileBounds m.Extrema) []uint32 {
-	s.lastx = 0
-	s.lasty = 0
-	mvtGeometry := make([]uint32, 0)
-
-	tolerance := TILE_DIMENSION_AT_0 / math.Pow(2, float64(tile.Z)) / 256 * SIMPLIFICATION_FACTOR
-
-	simplifiedGeometry := geometry.SimplifyPreservingTopology(tolerance)
-	defer simplifiedGeometry.Destroy()
-
-	geomcount := simplifiedGeometry.GeometryCount()
-	pointCount := simplifiedGeometry.PointCount()
-
-	if geomcount > 0 {
-		for i := 0; i < geomcount; i++ {
-			geom := simplifiedGeometry.Geometry(i)
-			switch featureType {
-			case vectortile.Tile_POINT:
-				mvtGeometry = append(mvtGeometry, s.toMvtPointGeometry(&geom, tileBounds)...)
-			case vectortile.Tile_LINESTRING:
-				mvtGeometry = append(mvtGeometry, s.toMvtLinestringGeometry(&geom, tileBounds, false)...)
-			case vectortile.Tile_POLYGON:
-				mvtGeometry = append(mvtGeometry, s.toMvtPolygonGeometry(&geom, tileBounds, i > 0)...)
-			}
+// toTilePaths quantizes the parts to tile coordinates and drops what doesn't
+// survive the quantization: repeated vertices, the repeated closing vertex of
+// rings, lines of a single point and rings without area. The exterior ring
+// gets a positive and the holes a negative area.
+func toTilePaths(featureType vectortile.Tile_GeomType, geometry *tileGeometry, transform tileTransform) []path {
+	paths := make([]path, 0, len(geometry.parts))
+	for i, part := range geometry.parts {
+		p := make(path, len(part))
+		for j, pt := range part {
+			p[j].x, p[j].y = transform.toTileCoordinate(pt)
 		}
-	} else if pointCount > 0 {
 		switch featureType {
 		case vectortile.Tile_POINT:
-			mvtGeometry = append(mvtGeometry, s.toMvtPointGeometry(&simplifiedGeometry, tileBounds)...)
+			paths = append(paths, p)
 		case vectortile.Tile_LINESTRING:
-			mvtGeometry = append(mvtGeometry, s.toMvtLinestringGeometry(&simplifiedGeometry, tileBounds, false)...)
+			if p = removeDuplicates(p, false); len(p) > 1 {
+				paths = append(paths, p)
+			}
 		case vectortile.Tile_POLYGON:
-			mvtGeometry = append(mvtGeometry, s.toMvtPolygonGeometry(&simplifiedGeometry, tileBounds, false)...)
+			p = removeDuplicates(p, true)
+			area := ringArea(p)
+			if len(p) < 3 || area == 0 {
+				if i == 0 {
+					// without exterior ring the holes are meaningless
+					return paths
+				}
+				continue
+			}
+			if (i == 0) != (area > 0) {
+				reversePath(p)
+			}
+			paths = append(paths, p)
 		}
 	}
+	return paths
+}
 
-	return mvtGeometry
+// toMvtGeometry encodes a geometry that is already simplified for the zoom
+// level, a (multi)point is a single MoveTo with all points
+func (s *s57Tiler) toMvtGeometry(featureType vectortile.Tile_GeomType, simplifiedGeometry *tileGeometry, transform tileTransform) []uint32 {
+	return encodePaths(featureType, toTilePaths(featureType, simplifiedGeometry, transform))
 }
 
-func (s *s57Tiler) getMvtFeatureType(geometry *gdal.Geometry) *vectortile.Tile_GeomType {
-	geomType := geometry.Type()
+func (s *s57Tiler) getMvtFeatureType(geomType ogr.GeometryType) *vectortile.Tile_GeomType {
 	var mvtGeomType vectortile.Tile_GeomType
 	switch geomType {
-	case gdal.GT_LineString: //, gdal.GT_MultiLineString25D, gdal.GT_LineString25D, gdal.GT_MultiLineString:
+	case ogr.GT_LineString: //, ogr.GT_MultiLineString25D, ogr.GT_LineString25D, ogr.GT_MultiLineString:
 		mvtGeomType = vectortile.Tile_LINESTRING
-	case gdal.GT_Polygon: //, gdal.GT_MultiPolygon25D, gdal.GT_MultiPolygon, gdal.GT_Polygon25D:
+	case ogr.GT_Polygon: //, ogr.GT_MultiPolygon25D, ogr.GT_MultiPolygon, ogr.GT_Polygon25D:
 		mvtGeomType = vectortile.Tile_POLYGON
-	case gdal.GT_Point, gdal.GT_MultiPoint25D: //, gdal.GT_Point25D, gdal.GT_MultiPoint, gdal.GT_MultiPoint25D:
+	case ogr.GT_Point, ogr.GT_Point25D, ogr.GT_MultiPoint, ogr.GT_MultiPoint25D:
 		mvtGeomType = vectortile.Tile_POINT
 	default:
 		mvtGeomType = vectortile.Tile_UNKNOWN
@@ -240,113 +166,101 @@ func (s *s57Tiler) getMvtFeatureType(geometry *gdal.Geometry) *vectortile.Tile_G
 	return &mvtGeomType
 }
 
-func (s *s57Tiler) toMvtFeature(feature *gdal.Feature, tile m.TileID, tileBounds m.Extrema) *vectortile.Tile_Feature {
-	geom := feature.Geometry()
+func (s *s57Tiler) toMvtFeature(feature *cellFeature, tile m.TileID, transform tileTransform) *vectortile.Tile_Feature {
 	mvtFeature := vectortile.Tile_Feature{}
-	mvtFeature.Type = s.getMvtFeatureType(&geom)
+	mvtFeature.Type = s.getMvtFeatureType(feature.geomType)
 	if *mvtFeature.Type != vectortile.Tile_UNKNOWN {
+		simplifiedGeometry := s.simplifiedGeometry(feature, tile.Z)
+		mvtFeature.Geometry = s.toMvtGeometry(*mvtFeature.Type, simplifiedGeometry, transform)
+		if len(mvtFeature.Geometry) == 0 {
+			// nothing left after quantization to the tile
+			return nil
+		}
+		if feature.id != 0 {
+			id := feature.id
+			mvtFeature.Id = &id
+		}
 		// write tags
-		for i := 0; i < feature.FieldCount(); i++ {
-			fieldDef := feature.FieldDefinition(i)
-			key := fieldDef.Name()
-			var value interface{}
-			fieldType := fieldDef.Type()
-			vt := VT_STRING
-			if feature.IsFieldSet(i) {
-				switch fieldType {
-				case gdal.FT_StringList:
-					st := string(feature.FieldAsString(i))
-					value = st[strings.Index(st, ":")+1 : len(st)-1]
-					break
-				case gdal.FT_Integer:
-					vt = VT_INT
-					value = feature.FieldAsInteger64(i)
-					break
-				case gdal.FT_Real:
-					vt = VT_FLOAT
-					value = feature.FieldAsFloat64(i)
-					break
-				default:
-					value = feature.FieldAsString(i)
-					break
-				}
-				if value != "" {
-					if _, ok := s.keysMap[key]; !ok {
-						s.keysMap[key] = uint32(len(s.keys))
-						s.keys = append(s.keys, key)
-					}
-					vmk := ""
-					switch vt {
-					case VT_STRING:
-						vmk = fmt.Sprintf("%d_%s", vt, value)
-						break
-					case VT_INT:
-						vmk = fmt.Sprintf("%d_%d", vt, value)
-						break
-					case VT_FLOAT:
-						vmk = fmt.Sprintf("%d_%f", vt, value)
-						break
-					}
-
-					if _, ok := s.valuesMap[vmk]; !ok {
-						s.valuesMap[vmk] = uint32(len(s.values))
-						s.values = append(s.values, Value{fieldType: vt, value: value})
-					}
-					mvtFeature.Tags = append(mvtFeature.Tags, s.keysMap[key])
-					mvtFeature.Tags = append(mvtFeature.Tags, s.valuesMap[vmk])
-				}
+		for _, field := range feature.fields {
+			key := field.key
+			if key == "LNAM" && s.options.OmitLNAM {
+				continue
+			}
+			converted := s.convertValue(key, field.value, feature.units)
+			vt := converted.fieldType
+			value := converted.value
+			if _, ok := s.keysMap[key]; !ok {
+				s.keysMap[key] = uint32(len(s.keys))
+				s.keys = append(s.keys, key)
+			}
+			vmk := ""
+			switch vt {
+			case VT_STRING:
+				vmk = fmt.Sprintf("%d_%s", vt, value)
+				break
+			case VT_INT:
+				vmk = fmt.Sprintf("%d_%d", vt, value)
+				break
+			case VT_FLOAT:
+				vmk = fmt.Sprintf("%d_%f", vt, value)
+				break
+			}
+
+			if _, ok := s.valuesMap[vmk]; !ok {
+				s.valuesMap[vmk] = uint32(len(s.values))
+				s.values = append(s.values, converted)
 			}
+			mvtFeature.Tags = append(mvtFeature.Tags, s.keysMap[key])
+			mvtFeature.Tags = append(mvtFeature.Tags, s.valuesMap[vmk])
 		}
-		mvtFeature.Geometry = s.toMvtGeometry(*mvtFeature.Type, &geom, tile, tileBounds)
 		return &mvtFeature
 	}
 	return nil
 }
 
-func includeFeatureInTile(feature gdal.Feature, tile m.TileID) bool {
+func includeFeatureInTile(feature *cellFeature, tile m.TileID) bool {
 
 	scale := m.Scale(tile)
-	scaminIndex := feature.FieldIndex("SCAMIN")
-	if scaminIndex >= 0 {
-		scamin := feature.FieldAsFloat64(scaminIndex)
-		if scamin != 0 && scamin < float64(scale) {
-			return false
-		}
+	if feature.scamin != 0 && feature.scamin < float64(scale) {
+		return false
 	}
-	scamaxIndex := feature.FieldIndex("SCAMAX")
-	if scamaxIndex >= 0 {
-		scamax := feature.FieldAsFloat64(scamaxIndex)
-		if scamax != 0 && scamax > float64(scale) {
-			return false
-		}
+	if feature.scamax != 0 && feature.scamax > float64(scale) {
+		return false
 	}
 
 	return true
 }
 
-func (s *s57Tiler) GetFeatures(layer gdal.Layer, tile m.TileID, tileBounds m.Extrema) []*vectortile.Tile_Feature {
+// tileFeatures returns the features of the layer to include in the tile,
+// features within a buffer of a quarter tile around the tile are included
+func (s *s57Tiler) tileFeatures(file dataset.File, layerName string, tile m.TileID, tileBounds m.Extrema) []*cellFeature {
+
+	features := make([]*cellFeature, 0)
+	buffer := tileBuffer(tile.Z)
+	bounds := ogr.Envelope{}
+	bounds.SetMaxX(tileBounds.E + buffer)
+	bounds.SetMaxY(tileBounds.N + buffer)
+	bounds.SetMinX(tileBounds.W - buffer)
+	bounds.SetMinY(tileBounds.S - buffer)
+
+	for _, feature := range s.getCell(file).query(layerName, bounds) {
+		if includeFeatureInTile(feature, tile) {
+			features = append(features, feature)
+		}
+	}
 
-	features := make([]*vectortile.Tile_Feature, 0)
-	b2 := m.Bounds(m.TileID{X: tile.X + 1, Y: tile.Y, Z: tile.Z})
-	buffer := math.Abs(tileBounds.E-b2.E) / 4
-	bounds := m.Extrema{N: tileBounds.N + buffer, S: tileBounds.S - buffer, W: tileBounds.W - buffer, E: tileBounds.E + buffer}
+	return features
+}
 
-	layer.SetSpatialFilterRect(bounds.W, bounds.S, bounds.E, bounds.N)
+func (s *s57Tiler) GetFeatures(file dataset.File, layerName string, tile m.TileID, tileBounds m.Extrema) []*vectortile.Tile_Feature {
 
-	ok := true
+	features := make([]*vectortile.Tile_Feature, 0)
+	transform := newTileTransform(tileBounds)
 
-	for ok {
-		feature := layer.NextFeature()
-		if feature != nil {
-			if includeFeatureInTile(*feature, tile) {
-				mvtFeature := s.toMvtFeature(feature, tile, tileBounds)
-				if mvtFeature != nil {
-					features = append(features, mvtFeature)
-				}
-			}
-			feature.Destroy()
-		} else {
-			ok = false
+	for _, feature := range s.tileFeatures(file, layerName, tile, tileBounds) {
+		mvtFeature := s.toMvtFeature(feature, tile, transform)
+		if mvtFeature != nil {
+			features = append(features, mvtFeature)
 		}
 	}
 
@@ -371,14 +285,9 @@ func (s *s57Tiler) GetTilesForBounds(tiles map[string]m.TileID, bounds m.Extrema
 
 func (s *s57Tiler) GetTiles(file dataset.File, zoomLevel int) map[string]m.TileID {
 	tiles := make(map[string]m.TileID)
-	datasource := gdal.OpenDataSource(file.Path, 0)
-	defer datasource.Destroy()
-	for i := 0; i < datasource.LayerCount(); i++ {
-		l := datasource.LayerByIndex(i)
-		ext, err := l.Extent(true)
-		if err == nil {
-			tiles = s.GetTilesForBounds(tiles, m.Extrema{W: ext.MinX(), N: ext.MaxY(), E: ext.MaxX(), S: ext.MinY()}, zoomLevel)
-		}
+	for _, l := range file.Layers {
+		ext := l.Bounds
+		tiles = s.GetTilesForBounds(tiles, m.Extrema{W: ext.MinX(), N: ext.MaxY(), E: ext.MaxX(), S: ext.MinY()}, zoomLevel)
 	}
 	return tiles
 }
@@ -388,8 +297,6 @@ func getBounds(file dataset.File) []float32 {
 	var bounds []float32
 	layer, ok := file.Layers["M_COVR"]
 	if ok {
-		datasource := gdal.OpenDataSource(file.Path, 0)
-		defer datasource.Destroy()
 		bounds = make([]float32, 4)
 		bounds[0] = float32(layer.Bounds.MinX())
 		bounds[1] = float32(layer.Bounds.MinY())
@@ -400,87 +307,116 @@ func getBounds(file dataset.File) []float32 {
 	return bounds
 }
 
-func (s *s57Tiler) GenerateMetaData(outPath string, dataset dataset.Dataset, file dataset.File) {
+func (s *s57Tiler) GenerateMetaData(outPath string, dataset dataset.Dataset, file dataset.File) error {
 	path := filepath.Join(outPath, file.Id, "metadata.json")
 	bounds := getBounds(file)
 	metaData := charts.ChartMetaData{Id: file.Id, Name: file.Id, Description: dataset.Description, Created: time.Now().UTC(), Type: "S-57", Format: "pbf", MinZoom: s.minZoom, MaxZoom: s.maxZoom, Bounds: bounds}
 
+	// the units and datums of the cell are added to the chart metadata
 	out, _ := json.Marshal(metaData)
+	extended := make(map[string]interface{})
+	json.Unmarshal(out, &extended)
+	for k, v := range s.unitsMetaData(file) {
+		extended[k] = v
+	}
+	out, _ = json.Marshal(extended)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		os.MkdirAll(filepath.Dir(path), 0700) // Create your file
 	}
-	err := os.WriteFile(path, out, 0644)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return os.WriteFile(path, out, 0644)
 }
 
-func (s *s57Tiler) GenerateTile(outPath string, file dataset.File, tile m.TileID) {
-	mvtTile := vectortile.Tile{}
+func tileEnvelope(tile m.TileID) ogr.Envelope {
+	bounds := m.Bounds(tile)
+	envelope := ogr.Envelope{}
+	envelope.SetMaxX(bounds.E)
+	envelope.SetMaxY(bounds.N)
+	envelope.SetMinX(bounds.W)
+	envelope.SetMinY(bounds.S)
+	return envelope
+}
 
+func (s *s57Tiler) GenerateTile(outPath string, file dataset.File, tile m.TileID) error {
 	//allowedLayers := []string{"BOYLAT", "BOYCAR", "BOYINB", "BOYISD", "BOYSAW", "BOYSPP", "BCNLAT", "BCNCAR", "BCNISN", "BCNSAW", "BCNSPP", "LIGHTS", "DEPARE", "SEAARE", "COALNE", "RESARE", "UNSARE", "LNDARE", "BUAARE", "NAVLNE", "RECTRC", "CANALS"}
 
 	bounds := m.Bounds(tile)
-	tileEnvelope := gdal.Envelope{}
-	tileEnvelope.SetMaxX(bounds.E)
-	tileEnvelope.SetMaxY(bounds.N)
-	tileEnvelope.SetMinX(bounds.W)
-	tileEnvelope.SetMinY(bounds.S)
+	envelope := tileEnvelope(tile)
 
+	layers := make(map[string][]*cellFeature)
 	for layerName, layer := range file.Layers {
-		ln := layerName
-		var version uint32 = 2
-		var extent uint32 = TILE_EXTENT
-		s.startLayer()
-		mvtLayer := vectortile.Tile_Layer{Name: &ln, Version: &version, Extent: &extent}
-		datasource := gdal.OpenDataSource(file.Path, 0)
-		defer datasource.Destroy()
-		if layer.Bounds.Intersects(tileEnvelope) {
-			l := datasource.LayerByName(layerName)
-			c, ok := l.FeatureCount(false)
-			if ok && c > 0 {
-				features := s.GetFeatures(l, tile, bounds)
-				mvtLayer.Features = append(mvtLayer.Features, features...)
-			}
+		if layer.Bounds.Intersects(envelope) {
+			layers[layerName] = s.tileFeatures(file, layerName, tile, bounds)
 		}
-		if len(mvtLayer.Features) > 0 {
-			// keys
-			for _, k := range s.keys {
-				mvtLayer.Keys = append(mvtLayer.Keys, k)
-			}
-			// values
-			for _, v := range s.values {
-				value := vectortile.Tile_Value{}
-				switch v.fieldType {
-				case VT_STRING:
-					value.StringValue = ref.String(v.value)
-					break
-				case VT_FLOAT:
-					value.DoubleValue = ref.Float64(v.value)
-					break
-				case VT_INT:
-					value.IntValue = ref.Int64((v.value))
-					break
-				}
+	}
+	return s.writeTile(outPath, file, tile, layers)
+}
 
-				mvtLayer.Values = append(mvtLayer.Values, &value)
-			}
+func (s *s57Tiler) toMvtLayer(layerName string, features []*cellFeature, tile m.TileID, transform tileTransform) *vectortile.Tile_Layer {
+	ln := layerName
+	var version uint32 = 2
+	var extent uint32 = TILE_EXTENT
+	s.startLayer()
+	mvtLayer := vectortile.Tile_Layer{Name: &ln, Version: &version, Extent: &extent}
+	for _, feature := range features {
+		mvtFeature := s.toMvtFeature(feature, tile, transform)
+		if mvtFeature != nil {
+			mvtLayer.Features = append(mvtLayer.Features, mvtFeature)
+		}
+	}
+	if len(mvtLayer.Features) == 0 {
+		return nil
+	}
+	// keys
+	for _, k := range s.keys {
+		mvtLayer.Keys = append(mvtLayer.Keys, k)
+	}
+	// values
+	for _, v := range s.values {
+		value := vectortile.Tile_Value{}
+		switch v.fieldType {
+		case VT_STRING:
+			value.StringValue = ref.String(v.value)
+			break
+		case VT_FLOAT:
+			value.DoubleValue = ref.Float64(v.value)
+			break
+		case VT_INT:
+			value.IntValue = ref.Int64((v.value))
+			break
+		}
 
-			mvtTile.Layers = append(mvtTile.Layers, &mvtLayer)
+		mvtLayer.Values = append(mvtLayer.Values, &value)
+	}
+	return &mvtLayer
+}
+
+// writeTile encodes the features per layer of the tile and writes the tile,
+// an existing tile is removed when there is nothing to write
+func (s *s57Tiler) writeTile(outPath string, file dataset.File, tile m.TileID, layers map[string][]*cellFeature) error {
+	mvtTile := vectortile.Tile{}
+	transform := newTileTransform(m.Bounds(tile))
+
+	for layerName, features := range layers {
+		mvtLayer := s.toMvtLayer(layerName, features, tile, transform)
+		if mvtLayer != nil {
+			mvtTile.Layers = append(mvtTile.Layers, mvtLayer)
 		}
 	}
 
 	path := filepath.Join(outPath, file.Id, strconv.Itoa(int(tile.Z)), strconv.Itoa(int(tile.X)), strconv.Itoa(int(tile.Y))) + ".pbf"
+	if s.options.Validate {
+		for _, v := range ValidateTile(&mvtTile, s.options.Repair) {
+			v.Tile = m.Tilestr(tile)
+			s.violations[file.Id] = append(s.violations[file.Id], v)
+		}
+	}
 	if len(mvtTile.Layers) > 0 {
 		out, _ := proto.Marshal(&mvtTile)
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			os.MkdirAll(filepath.Dir(path), 0700) // Create your file
 		}
-		err := os.WriteFile(path, out, 0644)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		os.Remove(path)
+		return os.WriteFile(path, out, 0644)
 	}
+	os.Remove(path)
+	return nil
 }
@@ -0,0 +1,110 @@
+//go:build !purego
+
+package s57
+
+import (
+	"testing"
+
+	"github.com/lukeroth/gdal"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// gdalTileCoordinate is the projection to tile coordinates through the GDAL
+// coordinate transform from EPSG:4326 to EPSG:3857 that tileTransform
+// replaced, EPSG:4326 has latitude first
+func gdalTileCoordinate(transform gdal.CoordinateTransform, tileBounds m.Extrema, lon float64, lat float64) (int32, int32) {
+	to3857 := func(lon float64, lat float64) (float64, float64) {
+		xs := []float64{lat}
+		ys := []float64{lon}
+		zs := []float64{0}
+		transform.Transform(1, xs, ys, zs)
+		return xs[0], ys[0]
+	}
+	tx, ty := to3857(lon, lat)
+	ulx, uly := to3857(tileBounds.W, tileBounds.N)
+	lrx, lry := to3857(tileBounds.E, tileBounds.S)
+	xx := (tx - ulx) * TILE_EXTENT / (lrx - ulx)
+	yy := (uly - ty) * TILE_EXTENT / (uly - lry)
+	return int32(xx), int32(yy)
+}
+
+func lonLatPoints(geometry *ogr.Geometry) [][2]float64 {
+	points := make([][2]float64, 0)
+	for i := 0; i < geometry.GeometryCount(); i++ {
+		part := geometry.Geometry(i)
+		points = append(points, lonLatPoints(&part)...)
+	}
+	for i := 0; i < geometry.PointCount(); i++ {
+		x, y, _ := geometry.Point(i)
+		points = append(points, [2]float64{x, y})
+	}
+	return points
+}
+
+// every vertex of the test cell gets the same tile coordinates, within one
+// unit for rounding, as with the GDAL transform at all zoom levels
+func TestTileTransformMatchesGDAL(t *testing.T) {
+	ogr.RegisterS57()
+	src := gdal.CreateSpatialReference("")
+	src.FromEPSG(4326)
+	dst := gdal.CreateSpatialReference("")
+	dst.FromEPSG(3857)
+	transform := gdal.CreateCoordinateTransform(src, dst)
+	defer transform.Destroy()
+
+	ds, err := ogr.OpenDataSource("testdata/TEST0001.000", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Destroy()
+	compared := 0
+	for i := 0; i < ds.LayerCount(); i++ {
+		layer := ds.LayerByIndex(i)
+		for feature := layer.NextFeature(); feature != nil; feature = layer.NextFeature() {
+			geometry := feature.Geometry()
+			for _, p := range lonLatPoints(&geometry) {
+				for z := 9; z <= 18; z++ {
+					bounds := m.Bounds(m.Tile(p[0], p[1], z))
+					x, y := m.XY(p[0], p[1])
+					gotX, gotY := newTileTransform(bounds).toTileCoordinate(xy{x: x, y: y})
+					wantX, wantY := gdalTileCoordinate(transform, bounds, p[0], p[1])
+					if gotX-wantX > 1 || wantX-gotX > 1 || gotY-wantY > 1 || wantY-gotY > 1 {
+						t.Errorf("%v at zoom %d: %d,%d, GDAL %d,%d", p, z, gotX, gotY, wantX, wantY)
+					}
+					compared++
+				}
+			}
+			feature.Destroy()
+		}
+	}
+	if compared == 0 {
+		t.Fatal("no vertices compared")
+	}
+}
+
+// BenchmarkGDALTileTransform is BenchmarkTileTransform with the GDAL
+// coordinate transform per vertex, to compare the two
+func BenchmarkGDALTileTransform(b *testing.B) {
+	src := gdal.CreateSpatialReference("")
+	src.FromEPSG(4326)
+	dst := gdal.CreateSpatialReference("")
+	dst.FromEPSG(3857)
+	transform := gdal.CreateCoordinateTransform(src, dst)
+	defer transform.Destroy()
+
+	tile := m.Tile(4.9, 52.37, 14)
+	bounds := m.Bounds(tile)
+	line := denseLine(bounds, 100000)
+	var sum int64
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, p := range line {
+			x, y := gdalTileCoordinate(transform, bounds, p[0], p[1])
+			sum += int64(x) + int64(y)
+		}
+	}
+	if sum == 0 {
+		b.Fatal("line projected outside the tile")
+	}
+}
@@ -0,0 +1,59 @@
+package s57
+
+import (
+	"testing"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/vectortile"
+)
+
+// denseLine is a line of n vertices across the tile in lon/lat
+func denseLine(bounds m.Extrema, n int) [][2]float64 {
+	line := make([][2]float64, n)
+	for i := range line {
+		f := float64(i) / float64(n-1)
+		line[i][0] = bounds.W + f*(bounds.E-bounds.W)
+		line[i][1] = bounds.S + f*(bounds.N-bounds.S)
+	}
+	return line
+}
+
+// BenchmarkTileTransform projects a dense line to spherical mercator and
+// through the per-tile transform to tile coordinates
+func BenchmarkTileTransform(b *testing.B) {
+	tile := m.Tile(4.9, 52.37, 14)
+	bounds := m.Bounds(tile)
+	line := denseLine(bounds, 100000)
+	var sum int64
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		transform := newTileTransform(bounds)
+		for _, p := range line {
+			var point xy
+			point.x, point.y = m.XY(p[0], p[1])
+			x, y := transform.toTileCoordinate(point)
+			sum += int64(x) + int64(y)
+		}
+	}
+	if sum == 0 {
+		b.Fatal("line projected outside the tile")
+	}
+}
+
+// BenchmarkLinestringGeometry encodes a dense projected line as MVT geometry
+func BenchmarkLinestringGeometry(b *testing.B) {
+	tile := m.Tile(4.9, 52.37, 14)
+	bounds := m.Bounds(tile)
+	line := denseLine(bounds, 100000)
+	points := make([]xy, len(line))
+	for i, p := range line {
+		points[i].x, points[i].y = m.XY(p[0], p[1])
+	}
+	s := &s57Tiler{}
+	geometry := tileGeometry{parts: [][]xy{points}}
+	transform := newTileTransform(bounds)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s.toMvtGeometry(vectortile.Tile_LINESTRING, &geometry, transform)
+	}
+}
@@ -0,0 +1,140 @@
+package s57
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+)
+
+// file name of the search index in the output directory
+const SEARCH_INDEX = "search.json"
+
+// SearchEntry is a named feature in the search index
+type SearchEntry struct {
+	Name  string  `json:"name"`
+	Class string  `json:"class"`
+	Lon   float64 `json:"lon"`
+	Lat   float64 `json:"lat"`
+	Cell  string  `json:"cell"`
+	Band  int     `json:"band,omitempty"` // navigational purpose of the cell, 1 overview to 6 berthing
+	Id    uint64  `json:"id,omitempty"`
+}
+
+// usageBand returns the navigational purpose from the cell name, the third
+// character of a cell name is the usage band
+func usageBand(cellId string) int {
+	if len(cellId) > 2 && cellId[2] >= '1' && cellId[2] <= '6' {
+		return int(cellId[2] - '0')
+	}
+	return 0
+}
+
+// SearchEntries returns an entry for every name (OBJNAM and NOBJNM) of the
+// features of a cell
+func (s *s57Tiler) SearchEntries(file dataset.File) []SearchEntry {
+	entries := make([]SearchEntry, 0)
+	c := s.getCell(file)
+	for _, layerName := range sortedLayers(file) {
+		for _, feature := range c.layers[layerName] {
+			if feature.derived {
+				continue
+			}
+			for _, key := range []string{"OBJNAM", "NOBJNM"} {
+				name := strings.TrimSpace(feature.stringValue(key))
+				if name == "" {
+					continue
+				}
+				p := feature.labelPoint()
+				lon, lat := m.LngLat(p.x, p.y)
+				entries = append(entries, SearchEntry{Name: name, Class: layerName, Lon: lon, Lat: lat, Cell: file.Id, Band: usageBand(file.Id), Id: feature.id})
+			}
+		}
+	}
+	return entries
+}
+
+func WriteSearchIndex(path string, entries []SearchEntry) error {
+	out, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+func ReadSearchIndex(path string) ([]SearchEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]SearchEntry, 0)
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+var foldReplacer = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+)
+
+// fold makes names comparable regardless of case and accents
+func fold(name string) string {
+	return foldReplacer.Replace(strings.ToLower(name))
+}
+
+// Search returns the entries whose name contains the query, names starting
+// with the query first, then by usage band from large to small scale
+func Search(entries []SearchEntry, query string, limit int) []SearchEntry {
+	q := fold(strings.TrimSpace(query))
+	result := make([]SearchEntry, 0)
+	if q == "" {
+		return result
+	}
+	prefix := make(map[int]bool)
+	for _, e := range entries {
+		name := fold(e.Name)
+		if strings.Contains(name, q) {
+			prefix[len(result)] = strings.HasPrefix(name, q)
+			result = append(result, e)
+		}
+	}
+	order := make([]int, len(result))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if prefix[a] != prefix[b] {
+			return prefix[a]
+		}
+		return result[a].Band > result[b].Band
+	})
+	sorted := make([]SearchEntry, 0, len(result))
+	for _, i := range order {
+		if limit > 0 && len(sorted) >= limit {
+			break
+		}
+		sorted = append(sorted, result[i])
+	}
+	return sorted
+}
+
+// Search searches the names of the features of all datasets, the index is
+// built on the first search
+func (s *s57Tiler) Search(query string, limit int) []SearchEntry {
+	if s.searchIndex == nil {
+		s.searchIndex = make([]SearchEntry, 0)
+		for _, dataset := range s.datasets {
+			for _, file := range dataset.Files {
+				s.searchIndex = append(s.searchIndex, s.SearchEntries(file)...)
+			}
+		}
+	}
+	return Search(s.searchIndex, query, limit)
+}
@@ -0,0 +1,304 @@
+package s57
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+type SimplifyMethod int
+
+const (
+	SIMPLIFY_NONE SimplifyMethod = iota
+	SIMPLIFY_DOUGLAS_PEUCKER
+	SIMPLIFY_VISVALINGAM
+	SIMPLIFY_SHARED_EDGES // Douglas-Peucker on the edges shared between areas
+)
+
+// Simplification of a layer, the tolerance is in pixels of a 256 pixel tile
+type Simplification struct {
+	Method    SimplifyMethod
+	Tolerance float64
+}
+
+var simplifyMethods = map[string]SimplifyMethod{
+	"none":        SIMPLIFY_NONE,
+	"dp":          SIMPLIFY_DOUGLAS_PEUCKER,
+	"visvalingam": SIMPLIFY_VISVALINGAM,
+	"shared":      SIMPLIFY_SHARED_EDGES,
+}
+
+// DefaultSimplification is used for layers without a simplification of their own,
+// the "*" entry applies to all other layers
+var DefaultSimplification = map[string]Simplification{
+	"*":      {Method: SIMPLIFY_DOUGLAS_PEUCKER, Tolerance: SIMPLIFICATION_FACTOR},
+	"NAVLNE": {Method: SIMPLIFY_NONE},
+	"RECTRC": {Method: SIMPLIFY_NONE},
+	"LNDARE": {Method: SIMPLIFY_SHARED_EDGES, Tolerance: 2 * SIMPLIFICATION_FACTOR},
+	"DEPARE": {Method: SIMPLIFY_SHARED_EDGES, Tolerance: SIMPLIFICATION_FACTOR},
+	"DRGARE": {Method: SIMPLIFY_SHARED_EDGES, Tolerance: SIMPLIFICATION_FACTOR},
+}
+
+// ParseSimplification parses a list of layer=method[:tolerance] entries like
+// "LNDARE=dp:2,NAVLNE=none,*=visvalingam:1", the entries are added to the defaults
+func ParseSimplification(value string) (map[string]Simplification, error) {
+	simplification := make(map[string]Simplification)
+	for k, v := range DefaultSimplification {
+		simplification[k] = v
+	}
+	if value == "" {
+		return simplification, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid simplification %s", entry)
+		}
+		methodParts := strings.SplitN(parts[1], ":", 2)
+		method, ok := simplifyMethods[methodParts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown simplification method %s", methodParts[0])
+		}
+		tolerance := SIMPLIFICATION_FACTOR
+		if len(methodParts) == 2 {
+			t, err := strconv.ParseFloat(methodParts[1], 64)
+			if err != nil || t < 0 {
+				return nil, fmt.Errorf("invalid simplification tolerance %s", methodParts[1])
+			}
+			tolerance = t
+		}
+		simplification[parts[0]] = Simplification{Method: method, Tolerance: tolerance}
+	}
+	return simplification, nil
+}
+
+func (s *s57Tiler) layerSimplification(layerName string) Simplification {
+	simplification := s.options.Simplification
+	if simplification == nil {
+		simplification = DefaultSimplification
+	}
+	if l, ok := simplification[layerName]; ok {
+		return l
+	}
+	if l, ok := simplification["*"]; ok {
+		return l
+	}
+	return Simplification{Method: SIMPLIFY_DOUGLAS_PEUCKER, Tolerance: SIMPLIFICATION_FACTOR}
+}
+
+// xy is a point in spherical mercator meters
+type xy struct {
+	x float64
+	y float64
+}
+
+// tileGeometry is the geometry of a feature in spherical mercator meters. The
+// parts are the rings of a polygon with the exterior ring first, the line of
+// a linestring or the points of a (multi) point.
+type tileGeometry struct {
+	parts [][]xy
+}
+
+func projectPoints(geometry *ogr.Geometry) []xy {
+	points := make([]xy, geometry.PointCount())
+	for i := range points {
+		x, y, _ := geometry.Point(i)
+		points[i].x, points[i].y = m.XY(x, y)
+	}
+	return points
+}
+
+func projectGeometry(geometry *ogr.Geometry) tileGeometry {
+	projected := tileGeometry{}
+	if geomcount := geometry.GeometryCount(); geomcount > 0 {
+		for i := 0; i < geomcount; i++ {
+			geom := geometry.Geometry(i)
+			projected.parts = append(projected.parts, projectPoints(&geom))
+		}
+	} else if geometry.PointCount() > 0 {
+		projected.parts = append(projected.parts, projectPoints(geometry))
+	}
+	return projected
+}
+
+// metersPerPixel is the size of a pixel of a 256 pixel tile at the zoom level
+func metersPerPixel(zoom uint64) float64 {
+	return 2 * math.Pi * m.EARTH_RADIUS / 256 / math.Pow(2, float64(zoom))
+}
+
+func segmentDistance(p xy, a xy, b xy) float64 {
+	dx := b.x - a.x
+	dy := b.y - a.y
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+	t := ((p.x-a.x)*dx + (p.y-a.y)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+func douglasPeucker(points []xy, tolerance float64, keep []bool, first int, last int) {
+	maxDistance := 0.0
+	index := -1
+	for i := first + 1; i < last; i++ {
+		d := segmentDistance(points[i], points[first], points[last])
+		if d > maxDistance {
+			maxDistance = d
+			index = i
+		}
+	}
+	if index >= 0 && maxDistance > tolerance {
+		keep[index] = true
+		douglasPeucker(points, tolerance, keep, first, index)
+		douglasPeucker(points, tolerance, keep, index, last)
+	}
+}
+
+func simplifyDouglasPeucker(points []xy, tolerance float64) []xy {
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+	douglasPeucker(points, tolerance, keep, 0, len(points)-1)
+	result := make([]xy, 0)
+	for i, p := range points {
+		if keep[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func triangleArea(a xy, b xy, c xy) float64 {
+	return math.Abs((b.x-a.x)*(c.y-a.y)-(c.x-a.x)*(b.y-a.y)) / 2
+}
+
+// vertex of a line during Visvalingam simplification, ordered by the area of
+// the triangle it forms with its neighbours
+type vertex struct {
+	index int
+	area  float64
+	prev  *vertex
+	next  *vertex
+	heap  int
+}
+
+type vertexHeap []*vertex
+
+func (h vertexHeap) Len() int { return len(h) }
+func (h vertexHeap) Less(i, j int) bool {
+	if h[i].area == h[j].area {
+		return h[i].index < h[j].index
+	}
+	return h[i].area < h[j].area
+}
+func (h vertexHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heap = i
+	h[j].heap = j
+}
+func (h *vertexHeap) Push(x interface{}) {
+	v := x.(*vertex)
+	v.heap = len(*h)
+	*h = append(*h, v)
+}
+func (h *vertexHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// simplifyVisvalingam removes the vertices with the smallest effective area
+// until all remaining vertices have an area of at least the tolerance squared
+func simplifyVisvalingam(points []xy, tolerance float64) []xy {
+	if len(points) < 3 {
+		return points
+	}
+	minArea := tolerance * tolerance
+	vertices := make([]*vertex, len(points))
+	for i := range points {
+		vertices[i] = &vertex{index: i}
+		if i > 0 {
+			vertices[i].prev = vertices[i-1]
+			vertices[i-1].next = vertices[i]
+		}
+	}
+	h := make(vertexHeap, 0, len(points))
+	for _, v := range vertices[1 : len(points)-1] {
+		v.area = triangleArea(points[v.prev.index], points[v.index], points[v.next.index])
+		heap.Push(&h, v)
+	}
+	removed := make([]bool, len(points))
+	remaining := len(points)
+	for h.Len() > 0 && remaining > 2 {
+		v := heap.Pop(&h).(*vertex)
+		if v.area >= minArea {
+			break
+		}
+		removed[v.index] = true
+		remaining--
+		v.prev.next = v.next
+		v.next.prev = v.prev
+		for _, n := range []*vertex{v.prev, v.next} {
+			if n.prev == nil || n.next == nil {
+				continue
+			}
+			// an area never decreases, so a removed vertex never makes its
+			// neighbours easier to remove than itself
+			n.area = math.Max(v.area, triangleArea(points[n.prev.index], points[n.index], points[n.next.index]))
+			heap.Fix(&h, n.heap)
+		}
+	}
+	result := make([]xy, 0, remaining)
+	for i, p := range points {
+		if !removed[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// simplifyPoints simplifies a line or ring, a result with less than
+// minPoints is not a valid geometry so the original is kept
+func simplifyPoints(points []xy, method SimplifyMethod, tolerance float64, minPoints int) []xy {
+	if len(points) <= minPoints || tolerance <= 0 {
+		return points
+	}
+	var result []xy
+	switch method {
+	case SIMPLIFY_DOUGLAS_PEUCKER, SIMPLIFY_SHARED_EDGES:
+		result = simplifyDouglasPeucker(points, tolerance)
+	case SIMPLIFY_VISVALINGAM:
+		result = simplifyVisvalingam(points, tolerance)
+	default:
+		return points
+	}
+	if len(result) < minPoints {
+		return points
+	}
+	return result
+}
+
+// simplifyGeometry simplifies the projected geometry of a feature for the zoom level
+func simplifyGeometry(geometry tileGeometry, featureType ogr.GeometryType, simplification Simplification, zoom uint64, index *edgeIndex) tileGeometry {
+	tolerance := simplification.Tolerance * metersPerPixel(zoom)
+	simplified := tileGeometry{parts: make([][]xy, len(geometry.parts))}
+	for i, part := range geometry.parts {
+		switch {
+		case featureType == ogr.GT_LineString:
+			simplified.parts[i] = simplifyPoints(part, simplification.Method, tolerance, 2)
+		case featureType == ogr.GT_Polygon && simplification.Method == SIMPLIFY_SHARED_EDGES && index != nil:
+			simplified.parts[i] = index.simplifyRing(part, zoom)
+		case featureType == ogr.GT_Polygon:
+			simplified.parts[i] = simplifyPoints(part, simplification.Method, tolerance, 4)
+		default:
+			simplified.parts[i] = part
+		}
+	}
+	return simplified
+}
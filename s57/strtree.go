@@ -0,0 +1,132 @@
+package s57
+
+import (
+	"math"
+	"sort"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// maximum number of entries in a node of the STR-tree
+const STR_NODE_CAPACITY = 16
+
+// rect is an envelope in spherical mercator meters
+type rect struct {
+	minX float64
+	minY float64
+	maxX float64
+	maxY float64
+}
+
+func projectEnvelope(env ogr.Envelope) rect {
+	minX, minY := m.XY(env.MinX(), env.MinY())
+	maxX, maxY := m.XY(env.MaxX(), env.MaxY())
+	return rect{minX: minX, minY: minY, maxX: maxX, maxY: maxY}
+}
+
+func (r rect) intersects(other rect) bool {
+	return r.minX <= other.maxX && r.maxX >= other.minX && r.minY <= other.maxY && r.maxY >= other.minY
+}
+
+func (r rect) union(other rect) rect {
+	return rect{
+		minX: math.Min(r.minX, other.minX),
+		minY: math.Min(r.minY, other.minY),
+		maxX: math.Max(r.maxX, other.maxX),
+		maxY: math.Max(r.maxY, other.maxY),
+	}
+}
+
+func (r rect) centerX() float64 { return (r.minX + r.maxX) / 2 }
+func (r rect) centerY() float64 { return (r.minY + r.maxY) / 2 }
+
+// strNode is a node of the tree, leaves hold feature indices and the other
+// nodes hold child nodes
+type strNode struct {
+	bounds   rect
+	children []*strNode
+	items    []int
+}
+
+// strTree is a static R-tree bulk loaded with the Sort-Tile-Recursive
+// algorithm, the features of a cell never change after loading so the tree is
+// built once and only queried
+type strTree struct {
+	root   *strNode
+	bounds []rect
+}
+
+// sortTileRecursive packs the nodes in groups of STR_NODE_CAPACITY, the nodes
+// are sorted in vertical slices by x and within a slice by y
+func sortTileRecursive(nodes []*strNode) [][]*strNode {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].bounds.centerX() < nodes[j].bounds.centerX() })
+	leafCount := int(math.Ceil(float64(len(nodes)) / STR_NODE_CAPACITY))
+	sliceCount := int(math.Ceil(math.Sqrt(float64(leafCount))))
+	sliceSize := sliceCount * STR_NODE_CAPACITY
+	groups := make([][]*strNode, 0, leafCount)
+	for start := 0; start < len(nodes); start += sliceSize {
+		end := int(math.Min(float64(start+sliceSize), float64(len(nodes))))
+		slice := nodes[start:end]
+		sort.Slice(slice, func(i, j int) bool { return slice[i].bounds.centerY() < slice[j].bounds.centerY() })
+		for i := 0; i < len(slice); i += STR_NODE_CAPACITY {
+			groups = append(groups, slice[i:int(math.Min(float64(i+STR_NODE_CAPACITY), float64(len(slice))))])
+		}
+	}
+	return groups
+}
+
+func newStrTree(bounds []rect) *strTree {
+	if len(bounds) == 0 {
+		return &strTree{bounds: bounds}
+	}
+	nodes := make([]*strNode, len(bounds))
+	for i, b := range bounds {
+		nodes[i] = &strNode{bounds: b, items: []int{i}}
+	}
+	// the leaves group the entries, every level above groups the level below
+	leaves := true
+	for len(nodes) > 1 || leaves {
+		parents := make([]*strNode, 0)
+		for _, group := range sortTileRecursive(nodes) {
+			parent := &strNode{bounds: group[0].bounds}
+			for _, n := range group {
+				parent.bounds = parent.bounds.union(n.bounds)
+				if leaves {
+					parent.items = append(parent.items, n.items...)
+				} else {
+					parent.children = append(parent.children, n)
+				}
+			}
+			parents = append(parents, parent)
+		}
+		nodes = parents
+		leaves = false
+	}
+	return &strTree{root: nodes[0], bounds: bounds}
+}
+
+// query returns the indices of all entries whose bounds intersect the area
+func (t *strTree) query(area rect) []int {
+	result := make([]int, 0)
+	if t.root == nil {
+		return result
+	}
+	stack := []*strNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !node.bounds.intersects(area) {
+			continue
+		}
+		stack = append(stack, node.children...)
+		for _, item := range node.items {
+			if t.bounds[item].intersects(area) {
+				result = append(result, item)
+			}
+		}
+	}
+	// keep the order of the features in the cell
+	sort.Ints(result)
+	return result
+}
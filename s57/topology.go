@@ -0,0 +1,164 @@
+package s57
+
+import (
+	"math"
+)
+
+// S-57 areas share their edges (VE records), after simplification and
+// quantisation adjacent areas only stay watertight when a shared edge is
+// simplified once and the same result is used for all areas referencing it.
+// The edges are found from the coordinates, so the same works for the rings
+// assembled by GDAL, which don't keep the edge records.
+
+func less(a xy, b xy) bool {
+	return a.x < b.x || a.x == b.x && a.y < b.y
+}
+
+type segment struct {
+	a xy
+	b xy
+}
+
+func newSegment(a xy, b xy) segment {
+	if less(b, a) {
+		return segment{a: b, b: a}
+	}
+	return segment{a: a, b: b}
+}
+
+// edgeKey identifies a run of vertices in its canonical direction
+type edgeKey struct {
+	first  xy
+	second xy
+	last   xy
+	count  int
+}
+
+// edgeIndex holds for every segment and vertex of the indexed areas the rings
+// using it, an edge is a run of segments used by the same rings. The
+// simplified edges are kept per zoom level.
+type edgeIndex struct {
+	segments   map[segment][]int
+	vertices   map[xy][]int
+	tolerances []float64 // tolerance in pixels per ring
+	edges      map[uint64]map[edgeKey][]xy
+}
+
+func newEdgeIndex() *edgeIndex {
+	return &edgeIndex{segments: make(map[segment][]int), vertices: make(map[xy][]int), edges: make(map[uint64]map[edgeKey][]xy)}
+}
+
+func appendRing(rings []int, ring int) []int {
+	if len(rings) > 0 && rings[len(rings)-1] == ring {
+		return rings
+	}
+	return append(rings, ring)
+}
+
+func (e *edgeIndex) addRing(points []xy, tolerance float64) {
+	ring := len(e.tolerances)
+	e.tolerances = append(e.tolerances, tolerance)
+	for i := 0; i < len(points)-1; i++ {
+		seg := newSegment(points[i], points[i+1])
+		e.segments[seg] = appendRing(e.segments[seg], ring)
+		e.vertices[points[i]] = appendRing(e.vertices[points[i]], ring)
+	}
+}
+
+func sameRings(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func reversePoints(points []xy) []xy {
+	reversed := make([]xy, len(points))
+	for i, p := range points {
+		reversed[len(points)-1-i] = p
+	}
+	return reversed
+}
+
+// simplifyEdge simplifies the run of vertices between two fixed vertices. The
+// run is simplified in its canonical direction, with the smallest tolerance of
+// the rings sharing it, and only once per zoom level.
+func (e *edgeIndex) simplifyEdge(run []xy, zoom uint64) []xy {
+	last := len(run) - 1
+	reversed := less(run[last], run[0]) || run[0] == run[last] && last > 1 && less(run[last-1], run[1])
+	if reversed {
+		run = reversePoints(run)
+	}
+	edges, ok := e.edges[zoom]
+	if !ok {
+		edges = make(map[edgeKey][]xy)
+		e.edges[zoom] = edges
+	}
+	key := edgeKey{first: run[0], second: run[1], last: run[last], count: len(run)}
+	result, ok := edges[key]
+	if !ok {
+		tolerance := math.Inf(1)
+		for _, ring := range e.segments[newSegment(run[0], run[1])] {
+			tolerance = math.Min(tolerance, e.tolerances[ring])
+		}
+		result = simplifyPoints(run, SIMPLIFY_DOUGLAS_PEUCKER, tolerance*metersPerPixel(zoom), 2)
+		edges[key] = result
+	}
+	if reversed {
+		result = reversePoints(result)
+	}
+	return result
+}
+
+// simplifyRing simplifies a closed ring edge by edge, the vertices where the
+// rings sharing the segments change are kept so the ring meets its neighbours
+// exactly
+func (e *edgeIndex) simplifyRing(ring []xy, zoom uint64) []xy {
+	n := len(ring) - 1
+	if n < 3 || ring[0] != ring[n] {
+		return ring
+	}
+	fixed := make([]bool, n)
+	anyFixed := false
+	for i := 0; i < n; i++ {
+		incoming := e.segments[newSegment(ring[(i+n-1)%n], ring[i])]
+		outgoing := e.segments[newSegment(ring[i], ring[i+1])]
+		if !sameRings(incoming, outgoing) || !sameRings(e.vertices[ring[i]], outgoing) {
+			fixed[i] = true
+			anyFixed = true
+		}
+	}
+	start := 0
+	if anyFixed {
+		for !fixed[start] {
+			start++
+		}
+	} else {
+		// a ring without fixed vertices starts at its lowest vertex
+		for i := 1; i < n; i++ {
+			if less(ring[i], ring[start]) {
+				start = i
+			}
+		}
+		fixed[start] = true
+	}
+	result := []xy{ring[start]}
+	run := []xy{ring[start]}
+	for k := 1; k <= n; k++ {
+		i := (start + k) % n
+		run = append(run, ring[i])
+		if fixed[i] {
+			result = append(result, e.simplifyEdge(run, zoom)[1:]...)
+			run = []xy{ring[i]}
+		}
+	}
+	if len(result) < 4 {
+		return ring
+	}
+	return result
+}
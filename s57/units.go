@@ -0,0 +1,188 @@
+package s57
+
+import (
+	"math"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// depth units of the tiles
+const (
+	DEPTH_METRES  = "metres"
+	DEPTH_FEET    = "feet"
+	DEPTH_FATHOMS = "fathoms"
+)
+
+// DSPM units of depth (DUNI) and height (HUNI) measurement
+const (
+	DUNI_METRES       = 1
+	DUNI_FATHOMS_FEET = 2 // whole fathoms, the decimal is the feet
+	DUNI_FEET         = 3
+	DUNI_FATHOMS      = 4 // fathoms and fractions of a fathom
+	HUNI_METRES       = 1
+	HUNI_FEET         = 2
+)
+
+const (
+	METRES_PER_FOOT   = 0.3048
+	METRES_PER_FATHOM = 1.8288
+)
+
+// attributes in the depth units of the cell
+var depthAttributes = map[string]bool{"DRVAL1": true, "DRVAL2": true, "VALSOU": true, "VALDCO": true, "SAFETY_DEPTH": true}
+
+// attributes in the height units of the cell
+var heightAttributes = map[string]bool{"HEIGHT": true, "ELEVAT": true, "VERLEN": true, "VERCLR": true, "VERCCL": true, "VERCOP": true, "VERCSA": true}
+
+// vertical and sounding datums (VERDAT)
+var verticalDatums = map[int]string{
+	1: "Mean low water springs", 2: "Mean lower low water springs", 3: "Mean sea level", 4: "Lowest low water", 5: "Mean low water",
+	6: "Lowest low water springs", 7: "Approximate mean low water springs", 8: "Indian spring low water", 9: "Low water springs",
+	10: "Approximate lowest astronomical tide", 11: "Nearly lowest low water", 12: "Mean lower low water", 13: "Low water",
+	14: "Approximate mean low water", 15: "Approximate mean lower low water", 16: "Mean high water", 17: "Mean high water springs",
+	18: "High water", 19: "Approximate mean sea level", 20: "High water springs", 21: "Mean higher high water",
+	22: "Equinoctial spring low water", 23: "Lowest astronomical tide", 24: "Local datum", 25: "International Great Lakes Datum 1985",
+	26: "Mean water level", 27: "Lower low water large tide", 28: "Higher high water large tide", 29: "Nearly highest high water",
+	30: "Highest astronomical tide",
+}
+
+var depthUnitNames = map[int]string{DUNI_METRES: "metres", DUNI_FATHOMS_FEET: "fathoms and feet", DUNI_FEET: "feet", DUNI_FATHOMS: "fathoms"}
+var heightUnitNames = map[int]string{HUNI_METRES: "metres", HUNI_FEET: "feet"}
+
+// cellUnits are the units and datums from the DSPM of a cell
+type cellUnits struct {
+	duni int
+	huni int
+	vdat int
+	sdat int
+}
+
+var metricUnits = cellUnits{duni: DUNI_METRES, huni: HUNI_METRES}
+
+func (u cellUnits) metric() bool {
+	return u.duni == DUNI_METRES && u.huni == HUNI_METRES
+}
+
+// readUnits reads the units and datums from the DSID layer, metres when the
+// cell doesn't have them
+func readUnits(datasource ogr.DataSource) cellUnits {
+	units := metricUnits
+	for i := 0; i < datasource.LayerCount(); i++ {
+		l := datasource.LayerByIndex(i)
+		if l.Name() != "DSID" {
+			continue
+		}
+		feature := l.NextFeature()
+		if feature == nil {
+			break
+		}
+		value := func(name string) int {
+			index := feature.FieldIndex(name)
+			if index < 0 || !feature.IsFieldSet(index) {
+				return 0
+			}
+			return feature.FieldAsInteger(index)
+		}
+		if duni := value("DSPM_DUNI"); duni != 0 {
+			units.duni = duni
+		}
+		if huni := value("DSPM_HUNI"); huni != 0 {
+			units.huni = huni
+		}
+		units.vdat = value("DSPM_VDAT")
+		units.sdat = value("DSPM_SDAT")
+		feature.Destroy()
+	}
+	return units
+}
+
+// depthToMetres converts a depth in the DUNI units to metres
+func depthToMetres(depth float64, duni int) float64 {
+	switch duni {
+	case DUNI_FATHOMS_FEET:
+		fathoms := math.Trunc(depth)
+		feet := math.Round((depth - fathoms) * 10)
+		return fathoms*METRES_PER_FATHOM + feet*METRES_PER_FOOT
+	case DUNI_FEET:
+		return depth * METRES_PER_FOOT
+	case DUNI_FATHOMS:
+		return depth * METRES_PER_FATHOM
+	}
+	return depth
+}
+
+// convertValue converts a depth or height attribute from the units of the
+// cell to the depth units of the tiles, heights are in feet for feet and
+// fathoms. Derived features without units are in metres.
+func (s *s57Tiler) convertValue(key string, value Value, units *cellUnits) Value {
+	if s.options.DepthUnits == "" || value.fieldType != VT_FLOAT {
+		return value
+	}
+	if units == nil {
+		units = &metricUnits
+	}
+	v := value.value.(float64)
+	var metres float64
+	switch {
+	case depthAttributes[key]:
+		if units.duni == DUNI_METRES && s.options.DepthUnits == DEPTH_METRES || units.duni == DUNI_FEET && s.options.DepthUnits == DEPTH_FEET ||
+			units.duni == DUNI_FATHOMS && s.options.DepthUnits == DEPTH_FATHOMS {
+			return value
+		}
+		metres = depthToMetres(v, units.duni)
+		if s.options.DepthUnits == DEPTH_FATHOMS {
+			return Value{fieldType: VT_FLOAT, value: math.Round(metres/METRES_PER_FATHOM*100) / 100}
+		}
+	case heightAttributes[key]:
+		if units.huni == HUNI_METRES && s.options.DepthUnits == DEPTH_METRES || units.huni == HUNI_FEET && s.options.DepthUnits != DEPTH_METRES {
+			return value
+		}
+		metres = v
+		if units.huni == HUNI_FEET {
+			metres = v * METRES_PER_FOOT
+		}
+	default:
+		return value
+	}
+	if s.options.DepthUnits == DEPTH_METRES {
+		return Value{fieldType: VT_FLOAT, value: math.Round(metres*100) / 100}
+	}
+	return Value{fieldType: VT_FLOAT, value: math.Round(metres/METRES_PER_FOOT*100) / 100}
+}
+
+// unitsMetaData returns the source units and datums of a cell and the depth
+// units of its tiles
+func (s *s57Tiler) unitsMetaData(file dataset.File) map[string]interface{} {
+	units := s.getCell(file).units
+	metaData := map[string]interface{}{
+		"sourceDepthUnits":  depthUnitNames[units.duni],
+		"sourceHeightUnits": heightUnitNames[units.huni],
+		"nonMetric":         !units.metric(),
+	}
+	if datum, ok := verticalDatums[units.vdat]; ok {
+		metaData["verticalDatum"] = datum
+	}
+	if datum, ok := verticalDatums[units.sdat]; ok {
+		metaData["soundingDatum"] = datum
+	}
+	if s.options.DepthUnits != "" {
+		metaData["depthUnits"] = s.options.DepthUnits
+	}
+	return metaData
+}
+
+// NonMetric tells whether the depths or heights of a cell are not in metres
+func (s *s57Tiler) NonMetric(file dataset.File) bool {
+	return !s.getCell(file).units.metric()
+}
+
+// depthValue returns a depth attribute of the feature in metres, the safety
+// depth of the route check and the unsafe water is in metres
+func (f *cellFeature) depthValue(key string) (float64, bool) {
+	depth, ok := f.floatValue(key)
+	if ok && f.units != nil {
+		depth = depthToMetres(depth, f.units.duni)
+	}
+	return depth, ok
+}
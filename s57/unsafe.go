@@ -0,0 +1,408 @@
+package s57
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// layer with the unsafe water of a cell, generated when a safety depth is set
+const UNSAFE_WATER_LAYER = "UNSAFE"
+
+// number of segments of the circle around a point danger
+const DANGER_SEGMENTS = 16
+
+// unsafeArea tells whether an area of the skin of the earth is unsafe for
+// the safety depth
+func unsafeArea(feature *cellFeature, safetyDepth float64) bool {
+	if feature.geomType != ogr.GT_Polygon {
+		return false
+	}
+	switch feature.layer {
+	case "LNDARE", "UNSARE":
+		return true
+	case "DEPARE", "DRGARE":
+		drval1, ok := feature.depthValue("DRVAL1")
+		return ok && drval1 < safetyDepth
+	}
+	return false
+}
+
+// unsafeDanger tells whether a point or area object is a danger for the
+// safety depth, a danger of unknown depth is always unsafe
+func unsafeDanger(feature *cellFeature, safetyDepth float64) bool {
+	if feature.geomType != ogr.GT_Point && feature.geomType != ogr.GT_Point25D && feature.geomType != ogr.GT_Polygon {
+		return false
+	}
+	switch feature.layer {
+	case "OBSTRN", "WRECKS", "UWTROC":
+		valsou, ok := feature.depthValue("VALSOU")
+		return !ok || valsou < safetyDepth
+	case "LNDARE":
+		return true
+	}
+	return false
+}
+
+// lonLatRings returns the rings of a polygon in lon/lat, the exterior ring
+// counterclockwise and the holes clockwise
+func lonLatRings(geometry *ogr.Geometry) [][]xy {
+	rings := make([][]xy, 0)
+	for i := 0; i < geometry.GeometryCount(); i++ {
+		ring := geometry.Geometry(i)
+		points := make([]xy, ring.PointCount())
+		for j := range points {
+			points[j].x, points[j].y, _ = ring.Point(j)
+		}
+		if len(points) < 4 {
+			continue
+		}
+		if (signedArea(points) > 0) != (i == 0) {
+			points = reversePoints(points)
+		}
+		rings = append(rings, points)
+	}
+	return rings
+}
+
+// signed area of a closed ring, positive for counterclockwise rings
+func signedArea(points []xy) float64 {
+	var sum float64 = 0
+	for i := 0; i < len(points)-1; i++ {
+		sum += cross(points[i], points[i+1])
+	}
+	return sum / 2
+}
+
+// dissolve merges polygons that don't overlap, like the skin of the earth
+// areas of a cell, into as few polygons as possible. A segment used by two
+// rings is a boundary between two of the polygons and is removed, the other
+// segments are chained into the rings of the result.
+func dissolve(polygons [][][]xy) [][][]xy {
+	count := make(map[segment]int)
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for i := 0; i < len(ring)-1; i++ {
+				count[newSegment(ring[i], ring[i+1])]++
+			}
+		}
+	}
+	// directed boundary segments by their start point
+	outgoing := make(map[xy][]xy)
+	starts := make([]xy, 0)
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for i := 0; i < len(ring)-1; i++ {
+				if ring[i] != ring[i+1] && count[newSegment(ring[i], ring[i+1])]%2 == 1 {
+					if len(outgoing[ring[i]]) == 0 {
+						starts = append(starts, ring[i])
+					}
+					outgoing[ring[i]] = append(outgoing[ring[i]], ring[i+1])
+				}
+			}
+		}
+	}
+	exteriors := make([][]xy, 0)
+	holes := make([][]xy, 0)
+	for _, start := range starts {
+		for len(outgoing[start]) > 0 {
+			ring := []xy{start}
+			current := start
+			for {
+				next := outgoing[current]
+				if len(next) == 0 {
+					break
+				}
+				outgoing[current] = next[1:]
+				current = next[0]
+				ring = append(ring, current)
+				if current == start {
+					break
+				}
+			}
+			if current != start || len(ring) < 4 {
+				continue
+			}
+			if signedArea(ring) > 0 {
+				exteriors = append(exteriors, ring)
+			} else {
+				holes = append(holes, ring)
+			}
+		}
+	}
+	result := make([][][]xy, len(exteriors))
+	for i, exterior := range exteriors {
+		result[i] = [][]xy{exterior}
+	}
+	// a hole belongs to the smallest exterior ring containing it
+	for _, hole := range holes {
+		inside := xy{x: (hole[0].x + hole[1].x) / 2, y: (hole[0].y + hole[1].y) / 2}
+		best := -1
+		for i, exterior := range exteriors {
+			if pointInRing(inside, exterior) && (best < 0 || signedArea(exterior) < signedArea(exteriors[best])) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			result[best] = append(result[best], hole)
+		}
+	}
+	return result
+}
+
+// circle returns a counterclockwise ring around a lon/lat position, the
+// radius is in meters
+func circle(center xy, radius float64) []xy {
+	dLat := radius / m.EARTH_RADIUS * 180 / math.Pi
+	dLon := dLat / math.Cos(math.Min(math.Abs(center.y), MAX_LATITUDE)*math.Pi/180)
+	ring := make([]xy, DANGER_SEGMENTS+1)
+	for i := 0; i < DANGER_SEGMENTS; i++ {
+		a := 2 * math.Pi * float64(i) / DANGER_SEGMENTS
+		ring[i] = xy{x: center.x + dLon*math.Cos(a), y: center.y + dLat*math.Sin(a)}
+	}
+	ring[DANGER_SEGMENTS] = ring[0]
+	return ring
+}
+
+// unsafeWater returns the polygons in lon/lat of the water of a cell that is
+// unsafe for the safety depth: the dissolved depth areas shallower than the
+// safety depth, land and unsurveyed areas, merged with the area dangers and a
+// circle around every point danger
+func unsafeWater(c *cell, safetyDepth float64, dangerRadius float64) [][][]xy {
+	areas := make([][][]xy, 0)
+	dangers := make([][][]xy, 0)
+	for _, features := range c.layers {
+		for _, feature := range features {
+			if feature.derived {
+				continue
+			}
+			if unsafeArea(feature, safetyDepth) {
+				if rings := lonLatRings(&feature.geometry); len(rings) > 0 {
+					areas = append(areas, rings)
+				}
+			} else if unsafeDanger(feature, safetyDepth) {
+				if feature.geomType == ogr.GT_Polygon {
+					if rings := lonLatRings(&feature.geometry); len(rings) > 0 {
+						dangers = append(dangers, rings)
+					}
+				} else {
+					x, y, _ := feature.geometry.Point(0)
+					dangers = append(dangers, [][]xy{circle(xy{x: x, y: y}, dangerRadius)})
+				}
+			}
+		}
+	}
+	return mergeDangers(dissolve(areas), dangers)
+}
+
+func ringRect(ring []xy) rect {
+	r := rect{minX: math.Inf(1), minY: math.Inf(1), maxX: math.Inf(-1), maxY: math.Inf(-1)}
+	for _, p := range ring {
+		r = r.union(rect{minX: p.x, minY: p.y, maxX: p.x, maxY: p.y})
+	}
+	return r
+}
+
+func pointInPolygon(p xy, polygon [][]xy) bool {
+	inside := false
+	for _, ring := range polygon {
+		if pointInRing(p, ring) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// segmentIntersection returns where segments ab and cd cross, an end point
+// when they touch there so both segments are split at the same point
+func segmentIntersection(a xy, b xy, c xy, d xy) (xy, bool) {
+	r := sub(b, a)
+	s := sub(d, c)
+	denominator := cross(r, s)
+	if denominator == 0 {
+		return xy{}, false
+	}
+	t := cross(sub(c, a), s) / denominator
+	u := cross(sub(c, a), r) / denominator
+	const eps = 1e-12
+	if t < -eps || t > 1+eps || u < -eps || u > 1+eps {
+		return xy{}, false
+	}
+	switch {
+	case t <= eps:
+		return a, true
+	case t >= 1-eps:
+		return b, true
+	case u <= eps:
+		return c, true
+	case u >= 1-eps:
+		return d, true
+	}
+	return xy{x: a.x + t*r.x, y: a.y + t*r.y}, true
+}
+
+// ringSegment is a segment of a ring of one of the polygons merged by
+// mergeDangers
+type ringSegment struct {
+	polygon int
+	ring    int
+	index   int
+}
+
+// mergeDangers unions the dangers with the dissolved areas, so the result has
+// no overlapping polygons. The rings are split where they cross, the pieces
+// inside another polygon are dropped and the remaining pieces are chained by
+// dissolve. The areas don't overlap each other, only the segments of the
+// dangers are crossed with the other segments, the candidates are found
+// through an STR-tree of the segments and of the polygons.
+func mergeDangers(areas [][][]xy, dangers [][][]xy) [][][]xy {
+	if len(dangers) == 0 {
+		return areas
+	}
+	polygons := append(append([][][]xy{}, areas...), dangers...)
+	polygonRects := make([]rect, len(polygons))
+	segments := make([]ringSegment, 0)
+	segmentRects := make([]rect, 0)
+	// the points where every segment is crossed, by polygon, ring and segment
+	splits := make([][][][]xy, len(polygons))
+	for i, polygon := range polygons {
+		polygonRects[i] = ringRect(polygon[0])
+		splits[i] = make([][][]xy, len(polygon))
+		for j, ring := range polygon {
+			splits[i][j] = make([][]xy, len(ring))
+			for k := 0; k < len(ring)-1; k++ {
+				segments = append(segments, ringSegment{polygon: i, ring: j, index: k})
+				segmentRects = append(segmentRects, ringRect(ring[k:k+2]))
+			}
+		}
+	}
+	polygonTree := newStrTree(polygonRects)
+	segmentTree := newStrTree(segmentRects)
+
+	for n, segment := range segments {
+		if segment.polygon < len(areas) {
+			continue
+		}
+		ring := polygons[segment.polygon][segment.ring]
+		for _, o := range segmentTree.query(segmentRects[n]) {
+			other := segments[o]
+			// a pair of dangers is crossed once, areas are crossed from the danger
+			if other.polygon == segment.polygon || (other.polygon >= len(areas) && other.polygon > segment.polygon) {
+				continue
+			}
+			otherRing := polygons[other.polygon][other.ring]
+			if p, ok := segmentIntersection(ring[segment.index], ring[segment.index+1], otherRing[other.index], otherRing[other.index+1]); ok {
+				splits[segment.polygon][segment.ring][segment.index] = append(splits[segment.polygon][segment.ring][segment.index], p)
+				splits[other.polygon][other.ring][other.index] = append(splits[other.polygon][other.ring][other.index], p)
+			}
+		}
+	}
+
+	pieces := make([][][]xy, 0)
+	for _, segment := range segments {
+		ring := polygons[segment.polygon][segment.ring]
+		a := ring[segment.index]
+		points := append([]xy{a}, splits[segment.polygon][segment.ring][segment.index]...)
+		sort.Slice(points, func(p, q int) bool {
+			return math.Hypot(points[p].x-a.x, points[p].y-a.y) < math.Hypot(points[q].x-a.x, points[q].y-a.y)
+		})
+		points = append(points, ring[segment.index+1])
+		for p := 0; p < len(points)-1; p++ {
+			if points[p] == points[p+1] {
+				continue
+			}
+			mid := xy{x: (points[p].x + points[p+1].x) / 2, y: (points[p].y + points[p+1].y) / 2}
+			inside := false
+			for _, k := range polygonTree.query(rect{minX: mid.x, minY: mid.y, maxX: mid.x, maxY: mid.y}) {
+				if k == segment.polygon || (segment.polygon < len(areas) && k < len(areas)) {
+					continue
+				}
+				if pointInPolygon(mid, polygons[k]) {
+					inside = true
+					break
+				}
+			}
+			if !inside {
+				pieces = append(pieces, [][]xy{{points[p], points[p+1]}})
+			}
+		}
+	}
+	return dissolve(pieces)
+}
+
+// addUnsafeWater adds the unsafe water of the cell as a layer, every polygon
+// is a feature of its own
+func (s *s57Tiler) addUnsafeWater(c *cell, file dataset.File) {
+	features := make([]*cellFeature, 0)
+	for _, polygon := range unsafeWater(c, s.options.SafetyDepth, s.options.DangerRadius) {
+		feature := &cellFeature{layer: UNSAFE_WATER_LAYER, derived: true, geomType: ogr.GT_Polygon, simplified: make(map[uint64]tileGeometry)}
+		feature.fields = append(feature.fields, fieldValue{key: "SAFETY_DEPTH", value: Value{fieldType: VT_FLOAT, value: s.options.SafetyDepth}})
+		minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, ring := range polygon {
+			projected := make([]xy, len(ring))
+			for i, p := range ring {
+				projected[i].x, projected[i].y = m.XY(p.x, p.y)
+				minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+				maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+			}
+			feature.projected.parts = append(feature.projected.parts, projected)
+		}
+		feature.envelope.SetMinX(minX)
+		feature.envelope.SetMinY(minY)
+		feature.envelope.SetMaxX(maxX)
+		feature.envelope.SetMaxY(maxY)
+		features = append(features, feature)
+	}
+	addDerivedLayer(c, file, UNSAFE_WATER_LAYER, features)
+}
+
+// addDerivedLayer adds a layer of derived features to the cell, with its
+// index, and to the layers of the file so it is tiled like the others
+func addDerivedLayer(c *cell, file dataset.File, layerName string, features []*cellFeature) {
+	if len(features) == 0 {
+		return
+	}
+	bounds := make([]rect, len(features))
+	layerMinX, layerMinY, layerMaxX, layerMaxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i, feature := range features {
+		bounds[i] = projectEnvelope(feature.envelope)
+		layerMinX, layerMinY = math.Min(layerMinX, feature.envelope.MinX()), math.Min(layerMinY, feature.envelope.MinY())
+		layerMaxX, layerMaxY = math.Max(layerMaxX, feature.envelope.MaxX()), math.Max(layerMaxY, feature.envelope.MaxY())
+	}
+	layerBounds := ogr.Envelope{}
+	layerBounds.SetMinX(layerMinX)
+	layerBounds.SetMinY(layerMinY)
+	layerBounds.SetMaxX(layerMaxX)
+	layerBounds.SetMaxY(layerMaxY)
+	c.layers[layerName] = features
+	c.indexes[layerName] = newStrTree(bounds)
+	file.Layers[layerName] = dataset.Layer{Name: layerName, Bounds: layerBounds}
+}
+
+// UnsafeWater returns the unsafe water of a cell as a MultiPolygon feature
+func (s *s57Tiler) UnsafeWater(file dataset.File) GeoJSONFeature {
+	coordinates := make([][][][]float64, 0)
+	for _, feature := range s.getCell(file).layers[UNSAFE_WATER_LAYER] {
+		coordinates = append(coordinates, projectedToGeoJSON(feature.projected))
+	}
+	properties := map[string]interface{}{"layer": UNSAFE_WATER_LAYER, "SAFETY_DEPTH": s.options.SafetyDepth}
+	return GeoJSONFeature{Type: "Feature", Geometry: &GeoJSONGeometry{Type: "MultiPolygon", Coordinates: coordinates}, Properties: properties}
+}
+
+// GenerateUnsafeWater writes the unsafe water of a cell to unsafe.geojson
+func (s *s57Tiler) GenerateUnsafeWater(outPath string, file dataset.File) error {
+	path := filepath.Join(outPath, file.Id, "unsafe.geojson")
+	collection := NewFeatureCollection()
+	collection.Features = append(collection.Features, s.UnsafeWater(file))
+	out, _ := json.Marshal(collection)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Dir(path), 0700)
+	}
+	return os.WriteFile(path, out, 0644)
+}
@@ -0,0 +1,180 @@
+package s57
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+)
+
+// rectangle returns a counterclockwise closed ring
+func rectangle(minX float64, minY float64, maxX float64, maxY float64) []xy {
+	return []xy{{minX, minY}, {maxX, minY}, {maxX, maxY}, {minX, maxY}, {minX, minY}}
+}
+
+// insideAny tells whether the point is inside one of the polygons and in how
+// many of them
+func insideAny(p xy, polygons [][][]xy) (bool, int) {
+	count := 0
+	for _, polygon := range polygons {
+		if pointInPolygon(p, polygon) {
+			count++
+		}
+	}
+	return count > 0, count
+}
+
+// checkUnion samples the bounds of the input and checks that the result
+// covers the same points as the input, by exactly one polygon
+func checkUnion(t *testing.T, input [][][]xy, result [][][]xy) {
+	t.Helper()
+	bounds := ringRect(input[0][0])
+	for _, polygon := range input {
+		bounds = bounds.union(ringRect(polygon[0]))
+	}
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 20000; n++ {
+		p := xy{x: bounds.minX + r.Float64()*(bounds.maxX-bounds.minX), y: bounds.minY + r.Float64()*(bounds.maxY-bounds.minY)}
+		want, _ := insideAny(p, input)
+		got, count := insideAny(p, result)
+		if got != want || count > 1 {
+			t.Fatalf("%v inside %d result polygons, inside the input %v", p, count, want)
+		}
+	}
+}
+
+// gridWithoutCenter returns the squares of a 3 x 3 grid without the center
+// square, the squares share their edges like the areas of a cell
+func gridWithoutCenter() [][][]xy {
+	squares := make([][][]xy, 0)
+	for x := 0.0; x < 3; x++ {
+		for y := 0.0; y < 3; y++ {
+			if x != 1 || y != 1 {
+				squares = append(squares, [][]xy{rectangle(x, y, x+1, y+1)})
+			}
+		}
+	}
+	return squares
+}
+
+func TestDissolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		polygons [][][]xy
+		want     int // number of polygons
+		holes    int // number of holes
+	}{
+		{"adjacent", [][][]xy{{rectangle(0, 0, 1, 1)}, {rectangle(1, 0, 2, 1)}}, 1, 0},
+		{"disjoint", [][][]xy{{rectangle(0, 0, 1, 1)}, {rectangle(2, 0, 3, 1)}}, 2, 0},
+		{"ring around a gap", gridWithoutCenter(), 1, 1},
+		{"island in a hole", [][][]xy{
+			{rectangle(0, 0, 3, 3), reversePoints(rectangle(1, 1, 2, 2))}, {rectangle(1.25, 1.25, 1.75, 1.75)},
+		}, 2, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := dissolve(test.polygons)
+			holes := 0
+			for _, polygon := range result {
+				holes += len(polygon) - 1
+				if signedArea(polygon[0]) <= 0 {
+					t.Errorf("exterior ring is not counterclockwise")
+				}
+			}
+			if len(result) != test.want || holes != test.holes {
+				t.Errorf("%d polygons with %d holes, want %d with %d", len(result), holes, test.want, test.holes)
+			}
+			checkUnion(t, test.polygons, result)
+		})
+	}
+}
+
+func TestMergeDangers(t *testing.T) {
+	land := dissolve([][][]xy{{rectangle(0, 0, 0.01, 0.01)}, {rectangle(0.02, 0, 0.05, 0.03), reversePoints(rectangle(0.03, 0.01, 0.04, 0.02))}})
+	tests := []struct {
+		name    string
+		dangers [][][]xy
+		want    int
+	}{
+		{"no dangers", nil, 2},
+		{"circle overlapping an area", [][][]xy{{circle(xy{0.01, 0.005}, 300)}}, 2},
+		{"overlapping circles", [][][]xy{{circle(xy{0.01, 0.005}, 300)}, {circle(xy{0.013, 0.005}, 300)}}, 2},
+		{"circle inside an area", [][][]xy{{circle(xy{0.005, 0.005}, 50)}}, 2},
+		{"circle in a hole", [][][]xy{{circle(xy{0.035, 0.015}, 100)}}, 3},
+		{"circle apart", [][][]xy{{circle(xy{0.1, 0.1}, 100)}}, 3},
+		{"area danger bridging two areas", [][][]xy{{rectangle(0.005, 0.002, 0.025, 0.004)}}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := mergeDangers(land, test.dangers)
+			if len(result) != test.want {
+				t.Errorf("%d polygons, want %d", len(result), test.want)
+			}
+			checkUnion(t, append(append([][][]xy{}, land...), test.dangers...), result)
+		})
+	}
+}
+
+// many dangers are merged through the STR-tree, not pair by pair
+func BenchmarkMergeDangers(b *testing.B) {
+	land := [][][]xy{{rectangle(0, 0, 1, 1)}}
+	dangers := make([][][]xy, 0)
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		dangers = append(dangers, [][]xy{circle(xy{r.Float64() * 2, r.Float64() * 2}, 500)})
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		mergeDangers(land, dangers)
+	}
+}
+
+func TestUnsafeFeatures(t *testing.T) {
+	feature := func(layer string, geomType ogr.GeometryType, key string, value float64) *cellFeature {
+		f := &cellFeature{layer: layer, geomType: geomType}
+		if key != "" {
+			f.fields = append(f.fields, fieldValue{key: key, value: Value{fieldType: VT_FLOAT, value: value}})
+		}
+		return f
+	}
+	tests := []struct {
+		name    string
+		feature *cellFeature
+		area    bool
+		danger  bool
+	}{
+		{"shallow depth area", feature("DEPARE", ogr.GT_Polygon, "DRVAL1", 2), true, false},
+		{"deep depth area", feature("DEPARE", ogr.GT_Polygon, "DRVAL1", 10), false, false},
+		{"depth area without depth", feature("DEPARE", ogr.GT_Polygon, "", 0), false, false},
+		{"land", feature("LNDARE", ogr.GT_Polygon, "", 0), true, true},
+		{"unsurveyed area", feature("UNSARE", ogr.GT_Polygon, "", 0), true, false},
+		{"shallow obstruction", feature("OBSTRN", ogr.GT_Point, "VALSOU", 2), false, true},
+		{"deep obstruction", feature("OBSTRN", ogr.GT_Point, "VALSOU", 10), false, false},
+		{"obstruction of unknown depth", feature("OBSTRN", ogr.GT_Point25D, "", 0), false, true},
+		{"shallow obstruction area", feature("OBSTRN", ogr.GT_Polygon, "VALSOU", 2), false, true},
+		{"deep wreck area", feature("WRECKS", ogr.GT_Polygon, "VALSOU", 10), false, false},
+		{"obstruction line", feature("OBSTRN", ogr.GT_LineString, "", 0), false, false},
+		{"land point", feature("LNDARE", ogr.GT_Point, "", 0), false, true},
+	}
+	for _, test := range tests {
+		if got := unsafeArea(test.feature, 5); got != test.area {
+			t.Errorf("%s: unsafe area %v, want %v", test.name, got, test.area)
+		}
+		if got := unsafeDanger(test.feature, 5); got != test.danger {
+			t.Errorf("%s: unsafe danger %v, want %v", test.name, got, test.danger)
+		}
+	}
+}
+
+func TestCircle(t *testing.T) {
+	ring := circle(xy{x: 4.5, y: 52.4}, 100)
+	if ring[0] != ring[len(ring)-1] || signedArea(ring) <= 0 {
+		t.Fatalf("circle is not a closed counterclockwise ring")
+	}
+	radius := (ring[DANGER_SEGMENTS/4].y - 52.4) * m.EARTH_RADIUS * math.Pi / 180
+	if math.Abs(radius-100) > 1e-6 {
+		t.Errorf("radius %.2f m, want 100 m", radius)
+	}
+}
@@ -0,0 +1,397 @@
+package s57
+
+// Validate encoded tiles against the MVT spec
+// see https://github.com/mapbox/vector-tile-spec/tree/master/2.1#43-geometry-encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/wdantuma/s57-tiler/s57/dataset"
+	"github.com/wdantuma/s57-tiler/s57/vectortile"
+)
+
+// file with the violations found in the tiles of a cell
+const VALIDATION_REPORT = "validation.json"
+
+const (
+	CMD_MOVE_TO    = 1
+	CMD_LINE_TO    = 2
+	CMD_CLOSE_PATH = 7
+)
+
+type Violation struct {
+	Tile    string `json:"tile,omitempty"`
+	Layer   string `json:"layer"`
+	Feature int    `json:"feature"` // -1 for a violation of the layer
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Feature < 0 {
+		return fmt.Sprintf("layer %s: %s", v.Layer, v.Message)
+	}
+	return fmt.Sprintf("layer %s, feature %d: %s", v.Layer, v.Feature, v.Message)
+}
+
+type tilePoint struct {
+	x int32
+	y int32
+}
+
+// a MoveTo/LineTo sequence in absolute tile coordinates
+type path []tilePoint
+
+func decodeCoordinate(v uint32) int32 {
+	return int32(v>>1) ^ -int32(v&1)
+}
+
+// surveyor's formula in tile coordinates, positive for exterior rings
+func ringArea(ring path) float64 {
+	var sum float64 = 0
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		sum += float64(ring[i].x)*float64(ring[j].y) - float64(ring[j].x)*float64(ring[i].y)
+	}
+	return sum / 2
+}
+
+// decodeGeometry checks the command stream and returns the decoded paths, for
+// polygons the ClosePath is implied by the path
+func decodeGeometry(geomType vectortile.Tile_GeomType, geometry []uint32, report func(string)) []path {
+	paths := make([]path, 0)
+	var cursor tilePoint
+	var current path
+	pointMoveTo := false
+	i := 0
+	for i < len(geometry) {
+		command := int(geometry[i] & 0x7)
+		count := int(geometry[i] >> 3)
+		i++
+		switch command {
+		case CMD_MOVE_TO, CMD_LINE_TO:
+			if count == 0 {
+				report(fmt.Sprintf("command %d with count 0", command))
+				continue
+			}
+			if i+count*2 > len(geometry) {
+				report(fmt.Sprintf("command %d with count %d exceeds geometry length", command, count))
+				i = len(geometry)
+				continue
+			}
+			if command == CMD_MOVE_TO {
+				if geomType != vectortile.Tile_POINT && count != 1 {
+					report(fmt.Sprintf("MoveTo with count %d", count))
+				}
+				if geomType == vectortile.Tile_POLYGON && current != nil {
+					report("ring without ClosePath")
+				}
+				// a (multi)point is a single MoveTo with a count per point
+				if geomType == vectortile.Tile_POINT && pointMoveTo {
+					report("repeated MoveTo in point geometry")
+				}
+				pointMoveTo = true
+				if current != nil {
+					paths = append(paths, current)
+				}
+				current = make(path, 0)
+			} else {
+				if geomType == vectortile.Tile_POINT {
+					report("LineTo in point geometry")
+				}
+				if current == nil {
+					report("LineTo without preceding MoveTo")
+					current = make(path, 0)
+				}
+			}
+			for n := 0; n < count; n++ {
+				dx := decodeCoordinate(geometry[i])
+				dy := decodeCoordinate(geometry[i+1])
+				i += 2
+				if command == CMD_LINE_TO && dx == 0 && dy == 0 {
+					report("zero-length segment")
+				}
+				cursor.x += dx
+				cursor.y += dy
+				current = append(current, cursor)
+				if command == CMD_MOVE_TO && geomType == vectortile.Tile_POINT {
+					paths = append(paths, current)
+					current = make(path, 0)
+				}
+			}
+			if command == CMD_MOVE_TO && geomType == vectortile.Tile_POINT {
+				current = nil
+			}
+		case CMD_CLOSE_PATH:
+			if count != 1 {
+				report(fmt.Sprintf("ClosePath with count %d", count))
+			}
+			if geomType != vectortile.Tile_POLYGON {
+				report("ClosePath in non polygon geometry")
+			}
+			if current == nil {
+				report("ClosePath without preceding MoveTo")
+				continue
+			}
+			if len(current) > 1 && current[0] == current[len(current)-1] {
+				report("ring repeats its first vertex before ClosePath")
+			}
+			paths = append(paths, current)
+			current = nil
+		default:
+			report(fmt.Sprintf("invalid command %d", command))
+			i = len(geometry)
+		}
+	}
+	if current != nil {
+		if geomType == vectortile.Tile_POLYGON {
+			report("ring without ClosePath")
+		}
+		paths = append(paths, current)
+	}
+	return paths
+}
+
+// insideRing tells whether the point is inside the ring, even-odd rule
+func insideRing(p tilePoint, ring path) bool {
+	inside := false
+	for i := range ring {
+		a := ring[i]
+		b := ring[(i+1)%len(ring)]
+		if (a.y > p.y) != (b.y > p.y) && float64(p.x) < float64(b.x-a.x)*float64(p.y-a.y)/float64(b.y-a.y)+float64(a.x) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// interiorRing tells whether a ring following the exterior ring is one of its
+// holes, a ring outside the exterior ring starts a new polygon
+func interiorRing(ring path, exterior path) bool {
+	return exterior != nil && len(ring) > 0 && insideRing(ring[0], exterior)
+}
+
+// removeDuplicates drops consecutive repeated vertices, and for rings the
+// repeated closing vertex
+func removeDuplicates(p path, ring bool) path {
+	result := make(path, 0, len(p))
+	for _, pt := range p {
+		if len(result) == 0 || result[len(result)-1] != pt {
+			result = append(result, pt)
+		}
+	}
+	if ring {
+		for len(result) > 1 && result[0] == result[len(result)-1] {
+			result = result[:len(result)-1]
+		}
+	}
+	return result
+}
+
+func reversePath(p path) {
+	for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+		p[i], p[j] = p[j], p[i]
+	}
+}
+
+// checkRings checks the winding order, the exterior ring has a positive
+// area and its interior rings a negative area
+func checkRings(rings []path, report func(string)) {
+	var exterior path
+	for i, ring := range rings {
+		ring = removeDuplicates(ring, true)
+		area := ringArea(ring)
+		if len(ring) < 3 || area == 0 {
+			report(fmt.Sprintf("ring %d has zero area", i))
+		} else if i == 0 && area < 0 {
+			report("first ring is not an exterior ring (negative area)")
+		} else if area > 0 && interiorRing(ring, exterior) {
+			report(fmt.Sprintf("interior ring %d has a positive area", i))
+		} else if area > 0 {
+			exterior = ring
+		}
+		if i == 0 {
+			exterior = ring
+		}
+	}
+}
+
+func repairPaths(geomType vectortile.Tile_GeomType, paths []path) []path {
+	repaired := make([]path, 0, len(paths))
+	switch geomType {
+	case vectortile.Tile_POINT:
+		repaired = paths
+	case vectortile.Tile_LINESTRING:
+		for _, p := range paths {
+			p = removeDuplicates(p, false)
+			if len(p) > 1 {
+				repaired = append(repaired, p)
+			}
+		}
+	case vectortile.Tile_POLYGON:
+		reverse := false
+		var exterior path
+		for i, p := range paths {
+			p = removeDuplicates(p, true)
+			area := ringArea(p)
+			if len(p) < 3 || area == 0 {
+				if i == 0 {
+					// without exterior ring the holes are meaningless
+					return repaired
+				}
+				continue
+			}
+			if i == 0 {
+				reverse = area < 0
+				exterior = p
+			}
+			if reverse {
+				reversePath(p)
+				area = -area
+			}
+			if i > 0 && area > 0 {
+				if interiorRing(p, exterior) {
+					reversePath(p)
+				} else {
+					exterior = p
+				}
+			}
+			repaired = append(repaired, p)
+		}
+	}
+	return repaired
+}
+
+func encodePaths(geomType vectortile.Tile_GeomType, paths []path) []uint32 {
+	geometry := make([]uint32, 0)
+	var cursor tilePoint
+	if geomType == vectortile.Tile_POINT {
+		count := 0
+		for _, p := range paths {
+			count += len(p)
+		}
+		if count == 0 {
+			return geometry
+		}
+		geometry = append(geometry, getCommand(CMD_MOVE_TO, count))
+	}
+	for _, p := range paths {
+		for i, pt := range p {
+			if geomType != vectortile.Tile_POINT {
+				if i == 0 {
+					geometry = append(geometry, getCommand(CMD_MOVE_TO, 1))
+				} else if i == 1 {
+					geometry = append(geometry, getCommand(CMD_LINE_TO, len(p)-1))
+				}
+			}
+			geometry = append(geometry, getCoordinate(pt.x-cursor.x), getCoordinate(pt.y-cursor.y))
+			cursor = pt
+		}
+		if geomType == vectortile.Tile_POLYGON {
+			geometry = append(geometry, getCommand(CMD_CLOSE_PATH, 1))
+		}
+	}
+	return geometry
+}
+
+// ValidateTile checks every layer and feature of the tile against the MVT 2.1
+// spec and returns the violations found. If repair is set the tile is fixed
+// in place, features which can't be repaired are dropped.
+func ValidateTile(tile *vectortile.Tile, repair bool) []Violation {
+	violations := make([]Violation, 0)
+	layers := make([]*vectortile.Tile_Layer, 0, len(tile.Layers))
+	layerNames := make(map[string]bool)
+	for _, layer := range tile.Layers {
+		name := layer.GetName()
+		reportLayer := func(message string) {
+			violations = append(violations, Violation{Layer: name, Feature: -1, Message: message})
+		}
+		if name == "" {
+			reportLayer("layer without name")
+		}
+		if layerNames[name] {
+			reportLayer("duplicate layer name")
+		}
+		layerNames[name] = true
+		if layer.GetVersion() != 2 {
+			reportLayer(fmt.Sprintf("layer version %d", layer.GetVersion()))
+		}
+
+		features := make([]*vectortile.Tile_Feature, 0, len(layer.Features))
+		ids := make(map[uint64]bool)
+		for index, feature := range layer.Features {
+			valid := true
+			report := func(message string) {
+				violations = append(violations, Violation{Layer: name, Feature: index, Message: message})
+			}
+			if feature.Id != nil {
+				if ids[*feature.Id] {
+					report(fmt.Sprintf("duplicate feature id %d", *feature.Id))
+					if repair {
+						feature.Id = nil
+					}
+				} else {
+					ids[*feature.Id] = true
+				}
+			}
+			if len(feature.Tags)%2 != 0 {
+				report("odd number of tags")
+				valid = false
+			}
+			for i := 0; i+1 < len(feature.Tags); i += 2 {
+				if int(feature.Tags[i]) >= len(layer.Keys) || int(feature.Tags[i+1]) >= len(layer.Values) {
+					report(fmt.Sprintf("tag %d refers to a missing key or value", i/2))
+					valid = false
+				}
+			}
+			geomType := feature.GetType()
+			if geomType == vectortile.Tile_UNKNOWN {
+				report("unknown geometry type")
+				valid = false
+			}
+			paths := decodeGeometry(geomType, feature.Geometry, report)
+			if geomType == vectortile.Tile_POLYGON {
+				checkRings(paths, report)
+			}
+			if repair {
+				paths = repairPaths(geomType, paths)
+				if len(paths) == 0 {
+					valid = false
+				}
+				if valid {
+					feature.Geometry = encodePaths(geomType, paths)
+				}
+			}
+			if valid || !repair {
+				features = append(features, feature)
+			}
+		}
+		layer.Features = features
+		if len(layer.Features) > 0 || !repair {
+			layers = append(layers, layer)
+		}
+	}
+	tile.Layers = layers
+	return violations
+}
+
+// WriteValidationReport writes the violations found in the tiles of the cell
+// to validation.json in the directory of the cell and returns their number,
+// the report is removed when there are none
+func (s *s57Tiler) WriteValidationReport(outPath string, file dataset.File) (int, error) {
+	path := filepath.Join(outPath, file.Id, VALIDATION_REPORT)
+	violations := s.violations[file.Id]
+	delete(s.violations, file.Id)
+	if len(violations) == 0 {
+		os.Remove(path)
+		return 0, nil
+	}
+	out, err := json.MarshalIndent(violations, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	os.MkdirAll(filepath.Dir(path), 0700)
+	return len(violations), os.WriteFile(path, out, 0644)
+}
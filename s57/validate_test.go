@@ -0,0 +1,295 @@
+package s57
+
+import (
+	"reflect"
+	"testing"
+
+	m "github.com/wdantuma/s57-tiler/s57/mercantile"
+	"github.com/wdantuma/s57-tiler/s57/ogr"
+	"github.com/wdantuma/s57-tiler/s57/vectortile"
+)
+
+// command is a MoveTo, LineTo or ClosePath with absolute tile coordinates
+type command struct {
+	id     int
+	points []tilePoint
+}
+
+func moveTo(points ...tilePoint) command { return command{id: CMD_MOVE_TO, points: points} }
+func lineTo(points ...tilePoint) command { return command{id: CMD_LINE_TO, points: points} }
+func closePath() command                 { return command{id: CMD_CLOSE_PATH} }
+
+func encodeCommands(commands ...command) []uint32 {
+	geometry := make([]uint32, 0)
+	var cursor tilePoint
+	for _, c := range commands {
+		if c.id == CMD_CLOSE_PATH {
+			geometry = append(geometry, getCommand(c.id, 1))
+			continue
+		}
+		geometry = append(geometry, getCommand(c.id, len(c.points)))
+		for _, p := range c.points {
+			geometry = append(geometry, getCoordinate(p.x-cursor.x), getCoordinate(p.y-cursor.y))
+			cursor = p
+		}
+	}
+	return geometry
+}
+
+func testTile(version uint32, features ...*vectortile.Tile_Feature) *vectortile.Tile {
+	name := "TEST"
+	extent := uint32(TILE_EXTENT)
+	return &vectortile.Tile{Layers: []*vectortile.Tile_Layer{{Name: &name, Version: &version, Extent: &extent, Features: features}}}
+}
+
+func testFeature(geomType vectortile.Tile_GeomType, geometry []uint32) *vectortile.Tile_Feature {
+	return &vectortile.Tile_Feature{Type: &geomType, Geometry: geometry}
+}
+
+func messages(violations []Violation) []string {
+	result := make([]string, 0)
+	for _, v := range violations {
+		result = append(result, v.Message)
+	}
+	return result
+}
+
+var (
+	square     = []tilePoint{{0, 0}, {100, 0}, {100, 100}, {0, 100}}
+	squareCCW  = []tilePoint{{0, 0}, {0, 100}, {100, 100}, {100, 0}}
+	hole       = []tilePoint{{20, 20}, {20, 80}, {80, 80}, {80, 20}}
+	holeCW     = []tilePoint{{20, 20}, {80, 20}, {80, 80}, {20, 80}}
+	farSquare  = []tilePoint{{200, 200}, {300, 200}, {300, 300}, {200, 300}}
+	collapsed  = []tilePoint{{10, 10}, {20, 20}, {30, 30}}
+	duplicated = []tilePoint{{0, 0}, {10, 0}, {10, 0}, {20, 0}}
+)
+
+func TestValidateTile(t *testing.T) {
+	tests := []struct {
+		name     string
+		geomType vectortile.Tile_GeomType
+		geometry []uint32
+		want     []string
+		repaired []uint32 // the geometry after repair, nil when the feature is dropped
+	}{
+		{
+			name:     "point",
+			geomType: vectortile.Tile_POINT,
+			geometry: encodeCommands(moveTo(tilePoint{5, 5})),
+			want:     []string{},
+			repaired: encodeCommands(moveTo(tilePoint{5, 5})),
+		},
+		{
+			name:     "multipoint with a MoveTo per point",
+			geomType: vectortile.Tile_POINT,
+			geometry: encodeCommands(moveTo(tilePoint{5, 5}), moveTo(tilePoint{6, 6})),
+			want:     []string{"repeated MoveTo in point geometry"},
+			repaired: encodeCommands(moveTo(tilePoint{5, 5}, tilePoint{6, 6})),
+		},
+		{
+			name:     "linestring with zero-length segment",
+			geomType: vectortile.Tile_LINESTRING,
+			geometry: encodeCommands(moveTo(duplicated[0]), lineTo(duplicated[1:]...)),
+			want:     []string{"zero-length segment"},
+			repaired: encodeCommands(moveTo(tilePoint{0, 0}), lineTo(tilePoint{10, 0}, tilePoint{20, 0})),
+		},
+		{
+			name:     "linestring of a single point",
+			geomType: vectortile.Tile_LINESTRING,
+			geometry: encodeCommands(moveTo(tilePoint{1, 1}), lineTo(tilePoint{1, 1})),
+			want:     []string{"zero-length segment"},
+			repaired: nil,
+		},
+		{
+			name:     "polygon",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath()),
+			want:     []string{},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath()),
+		},
+		{
+			name:     "polygon repeating its first vertex",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(append(square[1:], square[0])...), closePath()),
+			want:     []string{"ring repeats its first vertex before ClosePath"},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath()),
+		},
+		{
+			name:     "polygon without ClosePath",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(square[1:]...)),
+			want:     []string{"ring without ClosePath"},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath()),
+		},
+		{
+			name:     "polygon with negative exterior ring",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(squareCCW[0]), lineTo(squareCCW[1:]...), closePath()),
+			want:     []string{"first ring is not an exterior ring (negative area)"},
+			repaired: encodeCommands(moveTo(tilePoint{100, 0}), lineTo(tilePoint{100, 100}, tilePoint{0, 100}, tilePoint{0, 0}), closePath()),
+		},
+		{
+			name:     "polygon with hole",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath(), moveTo(hole[0]), lineTo(hole[1:]...), closePath()),
+			want:     []string{},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath(), moveTo(hole[0]), lineTo(hole[1:]...), closePath()),
+		},
+		{
+			name:     "polygon with positive interior ring",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath(), moveTo(holeCW[0]), lineTo(holeCW[1:]...), closePath()),
+			want:     []string{"interior ring 1 has a positive area"},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath(), moveTo(tilePoint{20, 80}), lineTo(tilePoint{80, 80}, tilePoint{80, 20}, tilePoint{20, 20}), closePath()),
+		},
+		{
+			name:     "multipolygon",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath(), moveTo(farSquare[0]), lineTo(farSquare[1:]...), closePath()),
+			want:     []string{},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath(), moveTo(farSquare[0]), lineTo(farSquare[1:]...), closePath()),
+		},
+		{
+			name:     "polygon without area",
+			geomType: vectortile.Tile_POLYGON,
+			geometry: encodeCommands(moveTo(collapsed[0]), lineTo(collapsed[1:]...), closePath()),
+			want:     []string{"ring 0 has zero area"},
+			repaired: nil,
+		},
+		{
+			name:     "ClosePath in linestring",
+			geomType: vectortile.Tile_LINESTRING,
+			geometry: encodeCommands(moveTo(square[0]), lineTo(square[1:]...), closePath()),
+			want:     []string{"ClosePath in non polygon geometry"},
+			repaired: encodeCommands(moveTo(square[0]), lineTo(square[1:]...)),
+		},
+		{
+			name:     "LineTo without MoveTo",
+			geomType: vectortile.Tile_LINESTRING,
+			geometry: encodeCommands(lineTo(square[1:]...)),
+			want:     []string{"LineTo without preceding MoveTo"},
+			repaired: encodeCommands(moveTo(square[1]), lineTo(square[2:]...)),
+		},
+		{
+			name:     "unknown geometry type",
+			geomType: vectortile.Tile_UNKNOWN,
+			geometry: encodeCommands(moveTo(tilePoint{5, 5})),
+			want:     []string{"unknown geometry type"},
+			repaired: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tile := testTile(2, testFeature(test.geomType, test.geometry))
+			if got := messages(ValidateTile(tile, false)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("violations %q, want %q", got, test.want)
+			}
+
+			ValidateTile(tile, true)
+			if test.repaired == nil {
+				if len(tile.Layers) != 0 {
+					t.Errorf("feature not dropped by repair")
+				}
+				return
+			}
+			if len(tile.Layers) != 1 || len(tile.Layers[0].Features) != 1 {
+				t.Fatalf("feature dropped by repair")
+			}
+			if got := tile.Layers[0].Features[0].Geometry; !reflect.DeepEqual(got, test.repaired) {
+				t.Errorf("repaired geometry %v, want %v", got, test.repaired)
+			}
+			if got := messages(ValidateTile(tile, false)); len(got) != 0 {
+				t.Errorf("violations after repair %q", got)
+			}
+		})
+	}
+}
+
+func TestValidateTileLayer(t *testing.T) {
+	id := uint64(1)
+	first := testFeature(vectortile.Tile_POINT, encodeCommands(moveTo(tilePoint{1, 1})))
+	first.Id = &id
+	second := testFeature(vectortile.Tile_POINT, encodeCommands(moveTo(tilePoint{2, 2})))
+	second.Id = &id
+	second.Tags = []uint32{0}
+	tile := testTile(1, first, second)
+
+	want := []Violation{
+		{Layer: "TEST", Feature: -1, Message: "layer version 1"},
+		{Layer: "TEST", Feature: 1, Message: "duplicate feature id 1"},
+		{Layer: "TEST", Feature: 1, Message: "odd number of tags"},
+	}
+	if got := ValidateTile(tile, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("violations %v, want %v", got, want)
+	}
+	if len(tile.Layers[0].Features) != 1 {
+		t.Errorf("feature with odd tags not dropped by repair")
+	}
+}
+
+func TestGetMvtFeatureType(t *testing.T) {
+	tests := map[ogr.GeometryType]vectortile.Tile_GeomType{
+		ogr.GT_Point:           vectortile.Tile_POINT,
+		ogr.GT_Point25D:        vectortile.Tile_POINT,
+		ogr.GT_MultiPoint:      vectortile.Tile_POINT,
+		ogr.GT_MultiPoint25D:   vectortile.Tile_POINT,
+		ogr.GT_LineString:      vectortile.Tile_LINESTRING,
+		ogr.GT_Polygon:         vectortile.Tile_POLYGON,
+		ogr.GT_MultiPolygon:    vectortile.Tile_UNKNOWN,
+		ogr.GT_MultiLineString: vectortile.Tile_UNKNOWN,
+	}
+	s := &s57Tiler{}
+	for geomType, want := range tests {
+		if got := *s.getMvtFeatureType(geomType); got != want {
+			t.Errorf("geometry type %v: %v, want %v", geomType, got, want)
+		}
+	}
+}
+
+// the encoder writes valid geometry whatever quantization to the tile does to
+// the rings and lines
+func TestToMvtGeometry(t *testing.T) {
+	tile := m.Tile(4.5, 52.4, 14)
+	bounds := m.Bounds(tile)
+	transform := newTileTransform(bounds)
+	point := func(fx float64, fy float64) xy {
+		x, y := m.XY(bounds.W+fx*(bounds.E-bounds.W), bounds.S+fy*(bounds.N-bounds.S))
+		return xy{x: x, y: y}
+	}
+	// a counterclockwise closed exterior ring, vertices closer than a tile unit
+	exterior := []xy{point(0.1, 0.1), point(0.1000001, 0.1), point(0.9, 0.1), point(0.9, 0.9), point(0.1, 0.9), point(0.1, 0.1)}
+	// a clockwise hole and a hole that collapses to a line in the tile
+	holeRing := []xy{point(0.4, 0.4), point(0.4, 0.6), point(0.6, 0.6), point(0.6, 0.4), point(0.4, 0.4)}
+	sliver := []xy{point(0.2, 0.2), point(0.3, 0.2), point(0.3, 0.2000001), point(0.2, 0.2)}
+	// a line whose points all fall in one tile unit
+	short := []xy{point(0.5, 0.5), point(0.5000001, 0.5000001)}
+
+	tests := []struct {
+		name     string
+		geomType vectortile.Tile_GeomType
+		geometry tileGeometry
+		rings    int
+	}{
+		{"polygon", vectortile.Tile_POLYGON, tileGeometry{parts: [][]xy{exterior, holeRing, sliver}}, 2},
+		{"reversed polygon", vectortile.Tile_POLYGON, tileGeometry{parts: [][]xy{reversePoints(exterior), reversePoints(holeRing)}}, 2},
+		{"line", vectortile.Tile_LINESTRING, tileGeometry{parts: [][]xy{exterior, short}}, 1},
+		{"multipoint", vectortile.Tile_POINT, tileGeometry{parts: [][]xy{{point(0.2, 0.2)}, {point(0.3, 0.3)}}}, 2},
+	}
+	s := &s57Tiler{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			geometry := s.toMvtGeometry(test.geomType, &test.geometry, transform)
+			violations := ValidateTile(testTile(2, testFeature(test.geomType, geometry)), false)
+			if len(violations) != 0 {
+				t.Errorf("violations %q", messages(violations))
+			}
+			paths := decodeGeometry(test.geomType, geometry, func(string) {})
+			if len(paths) != test.rings {
+				t.Errorf("%d paths, want %d", len(paths), test.rings)
+			}
+		})
+	}
+	if geometry := s.toMvtGeometry(vectortile.Tile_LINESTRING, &tileGeometry{parts: [][]xy{short}}, transform); len(geometry) != 0 {
+		t.Errorf("line within one tile unit encoded as %v", geometry)
+	}
+}
@@ -0,0 +1,177 @@
+package vsi
+
+// Reading files inside zip archives with the GDAL virtual file system syntax
+// /vsizip/<path to zip>/<path in zip>, GDAL opens these paths itself, this
+// package is for the pure Go reader, the catalog and the attachments
+// see https://gdal.org/user/virtual_file_systems.html#vsizip-zip-archives
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const ZIP_PREFIX = "/vsizip/"
+
+var (
+	archivesMutex sync.Mutex
+	archives      = make(map[string]*zip.ReadCloser)
+)
+
+// IsZip returns true for a path to a zip archive
+func IsZip(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".zip")
+}
+
+// ZipPath returns the /vsizip/ path of a file in a zip archive, for an
+// absolute archive path this gives /vsizip//path/to.zip/member like GDAL expects
+func ZipPath(archive string, member string) string {
+	return ZIP_PREFIX + archive + "/" + member
+}
+
+// split returns the archive and the path in the archive of a /vsizip/ path
+func split(name string) (string, string, bool) {
+	if !strings.HasPrefix(name, ZIP_PREFIX) {
+		return "", "", false
+	}
+	rest := name[len(ZIP_PREFIX):]
+	i := strings.Index(strings.ToLower(rest), ".zip")
+	if i < 0 {
+		return "", "", false
+	}
+	archive := rest[:i+4]
+	member := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(rest[i+4:], "\\", "/")), "/")
+	return archive, member, true
+}
+
+// openArchive opens a zip archive once, archives stay open while the tiler runs
+func openArchive(archive string) (*zip.ReadCloser, error) {
+	archivesMutex.Lock()
+	defer archivesMutex.Unlock()
+	if r, ok := archives[archive]; ok {
+		return r, nil
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	archives[archive] = r
+	return r, nil
+}
+
+// Files returns the names of all files in a zip archive
+func Files(archive string) ([]string, error) {
+	r, err := openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f.Name)
+		}
+	}
+	return files, nil
+}
+
+func find(archive string, member string) (*zip.File, error) {
+	r, err := openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range r.File {
+		if strings.TrimPrefix(path.Clean("/"+f.Name), "/") == member {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", ZipPath(archive, member), fs.ErrNotExist)
+}
+
+// Open opens a file for reading, from a zip archive for a /vsizip/ path
+func Open(name string) (io.ReadCloser, error) {
+	archive, member, ok := split(name)
+	if !ok {
+		return os.Open(name)
+	}
+	f, err := find(archive, member)
+	if err != nil {
+		return nil, err
+	}
+	return f.Open()
+}
+
+// ReadFile reads a file, from a zip archive for a /vsizip/ path
+func ReadFile(name string) ([]byte, error) {
+	if _, _, ok := split(name); !ok {
+		return os.ReadFile(name)
+	}
+	rc, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Exists returns true when the file exists
+func Exists(name string) bool {
+	archive, member, ok := split(name)
+	if !ok {
+		_, err := os.Stat(name)
+		return err == nil
+	}
+	_, err := find(archive, member)
+	return err == nil
+}
+
+// ReadDir returns the names of the files in a directory
+func ReadDir(dir string) ([]string, error) {
+	archive, member, ok := split(dir)
+	if !ok {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+		return names, nil
+	}
+	files, err := Files(archive)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, f := range files {
+		f = strings.TrimPrefix(path.Clean("/"+f), "/")
+		if path.Dir(f) == member || (member == "" && path.Dir(f) == ".") {
+			names = append(names, path.Base(f))
+		}
+	}
+	return names, nil
+}
+
+// Dir returns the directory of a path, keeping the /vsizip/ prefix
+func Dir(name string) string {
+	if strings.HasPrefix(name, ZIP_PREFIX) {
+		return ZIP_PREFIX + filepath.Dir(name[len(ZIP_PREFIX):])
+	}
+	return filepath.Dir(name)
+}
+
+// Join joins a directory and a name, keeping the /vsizip/ prefix
+func Join(dir string, name string) string {
+	if strings.HasPrefix(dir, ZIP_PREFIX) {
+		return ZIP_PREFIX + filepath.Join(dir[len(ZIP_PREFIX):], name)
+	}
+	return filepath.Join(dir, name)
+}